@@ -0,0 +1,181 @@
+// Command iocconfig generates, lists and diffs the default config files of
+// the services packages, writes the JSON Schema of their sections and lists
+// the environment variables and flags overriding their keys.
+//
+//	iocconfig generate -dir ./configs -env prod
+//	iocconfig list -dir ./configs -env prod
+//	iocconfig diff -dir ./configs -env prod
+//	iocconfig schema -dir ./configs
+//	iocconfig env
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "github.com/aiechoic/services/database/gorm"
+	_ "github.com/aiechoic/services/database/redis"
+	_ "github.com/aiechoic/services/email"
+	_ "github.com/aiechoic/services/email/verify"
+	_ "github.com/aiechoic/services/gins"
+	"github.com/aiechoic/services/ioc"
+	_ "github.com/aiechoic/services/message/notifier/dingtalk"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: iocconfig <generate|list|diff|schema|env> [flags]\n\n")
+	fmt.Fprintf(os.Stderr, "  generate  write the default config of every section missing from dir\n")
+	fmt.Fprintf(os.Stderr, "  list      list the registered sections and their files in dir\n")
+	fmt.Fprintf(os.Stderr, "  diff      compare the keys of the sections in dir with their defaults\n")
+	fmt.Fprintf(os.Stderr, "  schema    write the JSON Schema of every section into dir\n")
+	fmt.Fprintf(os.Stderr, "  env       list the environment variable and flag of every key\n\n")
+	fmt.Fprintf(os.Stderr, "flags:\n")
+	newFlags("", &options{}).PrintDefaults()
+}
+
+type options struct {
+	dir   string
+	env   string
+	force bool
+}
+
+func newFlags(cmd string, opts *options) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	fs.StringVar(&opts.dir, "dir", "./configs", "config directory")
+	fs.StringVar(&opts.env, "env", string(ioc.ConfigEnvDev), "config environment, empty for base files")
+	fs.BoolVar(&opts.force, "force", false, "generate: overwrite the files of existing sections")
+	return fs
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd := os.Args[1]
+	var opts options
+	_ = newFlags(cmd, &opts).Parse(os.Args[2:])
+	env := ioc.ConfigEnv(opts.env)
+
+	var err error
+	switch cmd {
+	case "generate":
+		err = generate(opts.dir, env, opts.force)
+	case "list":
+		err = list(opts.dir, env)
+	case "diff":
+		err = diff(opts.dir, env)
+	case "schema":
+		err = schema(opts.dir)
+	case "env":
+		envVars()
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if errors.Is(err, errConfigDiff) {
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "iocconfig %s: %v\n", cmd, err)
+		os.Exit(1)
+	}
+}
+
+func generate(dir string, env ioc.ConfigEnv, force bool) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	files, err := ioc.WriteDefaultConfigs(dir, env, force)
+	for _, f := range files {
+		fmt.Printf("written %s\n", f)
+	}
+	if err == nil && len(files) == 0 {
+		fmt.Println("every section already exists")
+	}
+	return err
+}
+
+func list(dir string, env ioc.ConfigEnv) error {
+	diffs, err := ioc.DiffDefaultConfigs(dir, env)
+	if err != nil {
+		return err
+	}
+	for _, d := range diffs {
+		files := "missing"
+		if !d.Missing() {
+			files = strings.Join(d.Files, ", ")
+		}
+		fmt.Printf("%-24s %s\n", d.Section, files)
+	}
+	return nil
+}
+
+// errConfigDiff is returned by diff when a section differs from its default,
+// to exit with status 1.
+var errConfigDiff = errors.New("config differs from the defaults")
+
+func diff(dir string, env ioc.ConfigEnv) error {
+	diffs, err := ioc.DiffDefaultConfigs(dir, env)
+	if err != nil {
+		return err
+	}
+	changed := false
+	for _, d := range diffs {
+		switch {
+		case d.Missing():
+			fmt.Printf("%s: missing\n", d.Section)
+		case len(d.MissingKeys) > 0 || len(d.UnknownKeys) > 0:
+			fmt.Printf("%s:\n", d.Section)
+			for _, k := range d.MissingKeys {
+				fmt.Printf("  - %s (default only)\n", k)
+			}
+			for _, k := range d.UnknownKeys {
+				fmt.Printf("  + %s (not in default)\n", k)
+			}
+		default:
+			continue
+		}
+		changed = true
+	}
+	if changed {
+		return errConfigDiff
+	}
+	return nil
+}
+
+func schema(dir string) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	for _, d := range ioc.DefaultConfigs() {
+		s := d.Schema()
+		if s == nil {
+			continue
+		}
+		data, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			return err
+		}
+		filename := filepath.Join(dir, d.Section+".schema.json")
+		err = os.WriteFile(filename, append(data, '\n'), 0644)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("written %s\n", filename)
+	}
+	return nil
+}
+
+func envVars() {
+	for _, k := range ioc.ConfigKeys() {
+		fmt.Printf("%-40s --%s\n", k.EnvVar(), k.Flag())
+	}
+}
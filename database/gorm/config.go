@@ -53,6 +53,15 @@ func (c *Config) NewLogger() logger.Interface {
 }
 
 func (c *Config) Connect() (db *gorm.DB, close func() error) {
+	db, close, err := c.Open()
+	if err != nil {
+		panic(err)
+	}
+	return db, close
+}
+
+// Open is like Connect, but returns the errors instead of panicking.
+func (c *Config) Open() (db *gorm.DB, close func() error, err error) {
 	var dialer gorm.Dialector
 	switch c.Driver {
 	case "postgres":
@@ -64,20 +73,19 @@ func (c *Config) Connect() (db *gorm.DB, close func() error) {
 	case "sqlserver":
 		dialer = c.sqlserverDialer()
 	default:
-		panic(fmt.Errorf("unsupported database driver: %s", c.Driver))
+		return nil, nil, fmt.Errorf("unsupported database driver: %s", c.Driver)
 	}
-	var err error
 	db, err = gorm.Open(dialer, &gorm.Config{
 		Logger: c.NewLogger(),
 	})
 	if err != nil {
-		panic(err)
+		return nil, nil, err
 	}
 	sqlDB, err := db.DB()
 	if err != nil {
-		panic(err)
+		return nil, nil, err
 	}
-	return db, sqlDB.Close
+	return db, sqlDB.Close, nil
 }
 
 func (c *Config) postgresDialer() gorm.Dialector {
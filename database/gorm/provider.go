@@ -2,15 +2,30 @@ package gorm
 
 import (
 	"github.com/aiechoic/services/ioc"
-	"github.com/spf13/viper"
 	"gorm.io/gorm"
-	"log"
 )
 
 const DefaultConfigSection = "gorm"
 
 var providers = ioc.NewProviders[*gorm.DB]()
 
+// instanceProviders hold the databases declared under the "instances" key,
+// each pinged by a health check.
+var instanceProviders = ioc.NewProviders[*gorm.DB]().WithHealthCheck(func(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Ping()
+})
+
+var swappableProviders = ioc.NewProviders[*ioc.Swappable[*gorm.DB]]()
+
+func init() {
+	ioc.RegisterDefaultConfig(DefaultConfigSection, defaultConfigData)
+	ioc.RegisterConfigType(DefaultConfigSection, Config{})
+}
+
 type ConfigSection string
 
 func GetProvider(section ConfigSection) *ioc.Provider[*gorm.DB] {
@@ -23,22 +38,87 @@ func GetProvider(section ConfigSection) *ioc.Provider[*gorm.DB] {
 		gdb, closer := cfg.Connect()
 		c.OnClose(closer)
 
-		err = c.WatchConfig(string(section), func(v *viper.Viper) {
-			var newCfg Config
-			err := v.Unmarshal(&newCfg)
-			if err != nil {
-				log.Println(err)
-				return
+		err = ioc.WatchTyped(c, string(section), defaultConfigData, func(newCfg *Config) error {
+			cfg.applyTo(gdb, newCfg)
+			logApplied(c, section)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return gdb, nil
+	})
+}
+
+// applyTo applies the settings of next that need no new connection to db,
+// opened with c, and reports whether next has no other change.
+func (c *Config) applyTo(db *gorm.DB, next *Config) bool {
+	if c.LogLevel != next.LogLevel {
+		db.Logger = next.NewLogger()
+		c.LogLevel = next.LogLevel
+	}
+	return *c == *next
+}
+
+func logApplied(c *ioc.Container, section ConfigSection) {
+	redacted, _ := c.RedactedConfig(string(section))
+	ioc.GetLogger(c, "database/gorm").Info("config applied", "section", section, "config", redacted)
+}
+
+// GetInstanceProvider returns the provider of the database declared as name
+// under the "instances" key of the gorm section.
+func GetInstanceProvider(name string) *ioc.Provider[*gorm.DB] {
+	return instanceProviders.GetInstanceProvider(DefaultConfigSection, name, newInstance)
+}
+
+// GetInstances returns the databases of every instance declared by the gorm
+// section, keyed by name.
+func GetInstances(c *ioc.Container) (map[string]*gorm.DB, error) {
+	return instanceProviders.GetInstances(c, DefaultConfigSection, defaultConfigData, newInstance)
+}
+
+func newInstance(c *ioc.Container, name string) (*gorm.DB, error) {
+	var cfg Config
+	err := c.UnmarshalInstanceConfig(DefaultConfigSection, name, &cfg, defaultConfigData)
+	if err != nil {
+		return nil, err
+	}
+	db, closer, err := cfg.Open()
+	if err != nil {
+		return nil, err
+	}
+	c.OnClose(closer)
+	return db, nil
+}
+
+// GetSwappableProvider is like GetProvider, but the connection is reopened
+// whenever the config section changes, for example to move to another host
+// or rotate credentials. The replaced connection is closed after
+// ioc.DefaultSwapGrace.
+func GetSwappableProvider(section ConfigSection) *ioc.Provider[*ioc.Swappable[*gorm.DB]] {
+	return swappableProviders.GetProvider(string(section), func(c *ioc.Container) (*ioc.Swappable[*gorm.DB], error) {
+		var db *gorm.DB
+		var cfg Config
+		return ioc.WatchSwappable(c, string(section), defaultConfigData, ioc.DefaultSwapGrace, func(newCfg *Config) (*gorm.DB, func() error, error) {
+			if db != nil && cfg.applyTo(db, newCfg) {
+				logApplied(c, section)
+				return nil, nil, ioc.ErrKeepInstance
 			}
-			if cfg.LogLevel != newCfg.LogLevel {
-				gdb.Logger = newCfg.NewLogger()
+			next, closer, err := newCfg.Open()
+			if err != nil {
+				return nil, nil, err
 			}
-			log.Printf("gorm config reloaded: %+v\n", newCfg)
+			db, cfg = next, *newCfg
+			logApplied(c, section)
+			return next, closer, nil
 		})
-		return gdb, nil
 	})
 }
 
+func GetSwappableGormDB(c *ioc.Container) *ioc.Swappable[*gorm.DB] {
+	return GetSwappableProvider(DefaultConfigSection).MustGet(c)
+}
+
 func GetGormDB(c *ioc.Container) *gorm.DB {
 	return GetProvider(DefaultConfigSection).MustGet(c)
 }
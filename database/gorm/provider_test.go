@@ -0,0 +1,70 @@
+package gorm_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aiechoic/services/database/gorm"
+	"github.com/aiechoic/services/ioc"
+	"github.com/stretchr/testify/assert"
+	gormio "gorm.io/gorm"
+)
+
+func TestGetSwappableProvider(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig := func(file string) {
+		content := fmt.Sprintf("driver: sqlite\nsqlite_file: %q\nlog_level: 1\n", filepath.Join(dir, file))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "gorm-swap.test.yaml"), []byte(content), 0644))
+	}
+	writeConfig("a.db")
+
+	c := ioc.NewContainer()
+	defer c.Close()
+	assert.NoError(t, c.LoadConfig(dir, ioc.ConfigEnvTest))
+
+	db := gorm.GetSwappableProvider("gorm-swap").MustGet(c)
+	swapped := make(chan *gormio.DB, 1)
+	db.OnSwap(func(next *gormio.DB) {
+		swapped <- next
+	})
+	assert.NoError(t, db.Get().Exec("CREATE TABLE a (id INTEGER)").Error)
+
+	writeConfig("b.db")
+	select {
+	case next := <-swapped:
+		assert.Same(t, next, db.Get())
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection not reopened")
+	}
+	// the accessor now reaches b.db, which has no table a
+	assert.Error(t, db.Get().Exec("SELECT * FROM a").Error)
+	assert.NoError(t, db.Get().Exec("CREATE TABLE b (id INTEGER)").Error)
+}
+
+func TestGetInstances(t *testing.T) {
+	dir := t.TempDir()
+	c := ioc.NewContainer()
+	defer c.Close()
+	assert.NoError(t, c.LoadConfigMap(map[string]map[string]any{
+		gorm.DefaultConfigSection: {
+			"driver":    "sqlite",
+			"log_level": 1,
+			"instances": map[string]any{
+				"main":    map[string]any{"sqlite_file": filepath.Join(dir, "main.db")},
+				"reports": map[string]any{"sqlite_file": filepath.Join(dir, "reports.db")},
+			},
+		},
+	}))
+
+	dbs, err := gorm.GetInstances(c)
+	assert.NoError(t, err)
+	assert.Len(t, dbs, 2)
+	assert.Same(t, dbs["reports"], gorm.GetInstanceProvider("reports").MustGet(c))
+	assert.NoError(t, dbs["main"].Exec("CREATE TABLE a (id INTEGER)").Error)
+	assert.Error(t, dbs["reports"].Exec("SELECT * FROM a").Error)
+	assert.Empty(t, c.CheckHealth(context.Background()))
+}
@@ -0,0 +1,49 @@
+package gorm
+
+import (
+	"context"
+	"fmt"
+	"github.com/aiechoic/services/ioc"
+	"gorm.io/gorm"
+	"time"
+)
+
+// ConfigRow is a config section stored in a SQL table, its content a JSON,
+// YAML or TOML document.
+type ConfigRow struct {
+	Section   string `gorm:"primaryKey"`
+	Content   string
+	UpdatedAt time.Time
+}
+
+type configSource struct {
+	db    *gorm.DB
+	table string
+}
+
+// NewConfigSource returns a config source reading the sections stored as
+// ConfigRows in table.
+func NewConfigSource(db *gorm.DB, table string) ioc.ConfigSource {
+	return &configSource{db: db, table: table}
+}
+
+func (s *configSource) String() string {
+	return fmt.Sprintf("sql:%s", s.table)
+}
+
+func (s *configSource) Load(ctx context.Context) (map[string]map[string]any, error) {
+	var rows []ConfigRow
+	err := s.db.WithContext(ctx).Table(s.table).Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	sections := map[string]map[string]any{}
+	for _, row := range rows {
+		settings, err := ioc.DecodeConfig([]byte(row.Content))
+		if err != nil {
+			return nil, fmt.Errorf("section \"%s\": %w", row.Section, err)
+		}
+		sections[row.Section] = settings
+	}
+	return sections, nil
+}
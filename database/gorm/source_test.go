@@ -0,0 +1,50 @@
+package gorm_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aiechoic/services/database/gorm"
+	"github.com/aiechoic/services/ioc"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	gormio "gorm.io/gorm"
+)
+
+func TestConfigSource(t *testing.T) {
+	db, err := gormio.Open(sqlite.Open(filepath.Join(t.TempDir(), "config.db")), &gormio.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.Table("configs").AutoMigrate(&gorm.ConfigRow{}))
+	assert.NoError(t, db.Table("configs").Create(&gorm.ConfigRow{
+		Section: "email-sender",
+		Content: "port: \"465\"\n",
+	}).Error)
+
+	c := ioc.NewContainer()
+	defer c.Close()
+	assert.NoError(t, c.LoadConfigMap(map[string]map[string]any{
+		"email-sender": {"host": "smtp.example.com", "port": "25"},
+	}))
+	assert.NoError(t, c.AddConfigSource(context.Background(), gorm.NewConfigSource(db, "configs"), 20*time.Millisecond))
+
+	changed := make(chan *viper.Viper, 1)
+	assert.NoError(t, c.UnmarshalAndWatchConfig("email-sender", nil, func(v *viper.Viper) {
+		changed <- v
+	}))
+	v := <-changed
+	assert.Equal(t, "smtp.example.com", v.GetString("host"))
+	assert.Equal(t, "465", v.GetString("port"))
+
+	assert.NoError(t, db.Table("configs").Where("section = ?", "email-sender").
+		Update("content", `{"port": "587"}`).Error)
+	select {
+	case v = <-changed:
+		assert.Equal(t, "smtp.example.com", v.GetString("host"))
+		assert.Equal(t, "587", v.GetString("port"))
+	case <-time.After(3 * time.Second): // sources are polled at most every second
+		t.Fatal("section not reloaded")
+	}
+}
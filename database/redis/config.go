@@ -4,9 +4,8 @@ import (
 	"context"
 	"fmt"
 	"github.com/redis/go-redis/v9"
-	"log"
+	"log/slog"
 	"net"
-	"os"
 )
 
 var defaultConfigData = []byte(
@@ -15,7 +14,7 @@ var defaultConfigData = []byte(
 # configure "redis.conf" for add user and password:
 # user yourusername on +@all ~* >somepassword
 
-# use debug mode
+# log every command at the debug level of the "database/redis" package
 debug: true
 # Redis server
 host: "localhost"
@@ -32,14 +31,30 @@ password: ""
 type Config struct {
 	Debug    bool   `mapstructure:"debug"`
 	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
 	Username string `mapstructure:"username"`
 	Password string `mapstructure:"password"`
 	DB       int    `mapstructure:"db"`
 }
 
+// addr returns the address of the server, on port 6379 unless set.
+func (r *Config) addr() string {
+	port := r.Port
+	if port == 0 {
+		port = 6379
+	}
+	return fmt.Sprintf("%s:%d", r.Host, port)
+}
+
 func (r *Config) NewClient() (*redis.Client, error) {
+	return r.newClient(slog.Default())
+}
+
+// newClient returns a client logging its commands to logger at the debug
+// level when debug is set.
+func (r *Config) newClient(logger *slog.Logger) (*redis.Client, error) {
 	c := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%d", r.Host, 6379),
+		Addr:     r.addr(),
 		Password: r.Password,
 		Username: r.Username,
 		DB:       r.DB,
@@ -49,24 +64,18 @@ func (r *Config) NewClient() (*redis.Client, error) {
 		return nil, err
 	}
 	if r.Debug {
-		c.AddHook(redisHook{
-			logger: log.New(os.Stderr, "redis: ", log.LstdFlags|log.Llongfile),
-		})
+		c.AddHook(redisHook{logger: logger})
 	}
 	return c, nil
 }
 
 type redisHook struct {
-	logger *log.Logger
-}
-
-func (h redisHook) printf(format string, v ...interface{}) {
-	_ = h.logger.Output(2, fmt.Sprintf(format, v...))
+	logger *slog.Logger
 }
 
 func (h redisHook) DialHook(next redis.DialHook) redis.DialHook {
 	return func(ctx context.Context, network, addr string) (net.Conn, error) {
-		h.logger.Printf("Dialing to %s:%s\n", network, addr)
+		h.logger.DebugContext(ctx, "dialing", "network", network, "addr", addr)
 		return next(ctx, network, addr)
 	}
 }
@@ -74,7 +83,7 @@ func (h redisHook) DialHook(next redis.DialHook) redis.DialHook {
 func (h redisHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
 	return func(ctx context.Context, cmd redis.Cmder) error {
 		err := next(ctx, cmd)
-		h.printf("command: %s, err: %v\n", cmd, err)
+		h.logger.DebugContext(ctx, "command", "cmd", cmd.String(), "error", err)
 		return err
 	}
 }
@@ -82,7 +91,7 @@ func (h redisHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
 func (h redisHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
 	return func(ctx context.Context, cmds []redis.Cmder) error {
 		err := next(ctx, cmds)
-		h.printf("pipeline: %v, err: %v\n", cmds, err)
+		h.logger.DebugContext(ctx, "pipeline", "cmds", fmt.Sprint(cmds), "error", err)
 		return err
 	}
 }
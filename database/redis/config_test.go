@@ -0,0 +1,26 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/aiechoic/services/ioc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigPort(t *testing.T) {
+	c := ioc.NewContainer()
+	defer c.Close()
+	assert.NoError(t, c.LoadConfigMap(map[string]map[string]any{
+		"redis-a": {"host": "cache", "port": 6380},
+		"redis-b": {"host": "cache"},
+	}))
+
+	var cfg Config
+	assert.NoError(t, c.UnmarshalConfig("redis-a", &cfg, defaultConfigData))
+	assert.Equal(t, 6380, cfg.Port)
+	assert.Equal(t, "cache:6380", cfg.addr())
+
+	cfg = Config{}
+	assert.NoError(t, c.UnmarshalConfig("redis-b", &cfg, defaultConfigData))
+	assert.Equal(t, "cache:6379", cfg.addr())
+}
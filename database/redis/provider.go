@@ -1,6 +1,7 @@
 package redis
 
 import (
+	"context"
 	"fmt"
 	"github.com/aiechoic/services/ioc"
 	"github.com/redis/go-redis/v9"
@@ -12,6 +13,19 @@ const (
 
 var providers = ioc.NewProviders[*redis.Client]()
 
+// instanceProviders hold the clients declared under the "instances" key,
+// each pinged by a health check.
+var instanceProviders = ioc.NewProviders[*redis.Client]().WithHealthCheck(func(client *redis.Client) error {
+	return client.Ping(context.Background()).Err()
+})
+
+var swappableProviders = ioc.NewProviders[*ioc.Swappable[*redis.Client]]()
+
+func init() {
+	ioc.RegisterDefaultConfig(string(DefaultConfigSection), defaultConfigData)
+	ioc.RegisterConfigType(string(DefaultConfigSection), Config{})
+}
+
 type ConfigSection string
 
 func GetProvider(section ConfigSection) *ioc.Provider[*redis.Client] {
@@ -21,7 +35,7 @@ func GetProvider(section ConfigSection) *ioc.Provider[*redis.Client] {
 		if err != nil {
 			return nil, err
 		}
-		client, err := cfg.NewClient()
+		client, err := cfg.newClient(ioc.GetLogger(c, "database/redis"))
 		if err != nil {
 			return nil, err
 		}
@@ -30,6 +44,32 @@ func GetProvider(section ConfigSection) *ioc.Provider[*redis.Client] {
 	})
 }
 
+// GetInstanceProvider returns the provider of the client declared as name
+// under the "instances" key of the redis section.
+func GetInstanceProvider(name string) *ioc.Provider[*redis.Client] {
+	return instanceProviders.GetInstanceProvider(string(DefaultConfigSection), name, newInstance)
+}
+
+// GetInstances returns the clients of every instance declared by the redis
+// section, keyed by name.
+func GetInstances(c *ioc.Container) (map[string]*redis.Client, error) {
+	return instanceProviders.GetInstances(c, string(DefaultConfigSection), defaultConfigData, newInstance)
+}
+
+func newInstance(c *ioc.Container, name string) (*redis.Client, error) {
+	var cfg Config
+	err := c.UnmarshalInstanceConfig(string(DefaultConfigSection), name, &cfg, defaultConfigData)
+	if err != nil {
+		return nil, err
+	}
+	client, err := cfg.newClient(ioc.GetLogger(c, "database/redis"))
+	if err != nil {
+		return nil, err
+	}
+	c.OnClose(client.Close)
+	return client, nil
+}
+
 func GetRedis(c *ioc.Container) *redis.Client {
 	config := DefaultConfigSection
 	client, err := GetProvider(config).Get(c)
@@ -38,3 +78,28 @@ func GetRedis(c *ioc.Container) *redis.Client {
 	}
 	return client
 }
+
+// GetSwappableProvider is like GetProvider, but the client is rebuilt
+// whenever the config section changes, for example to move to another host
+// or rotate credentials. The replaced client is closed after
+// ioc.DefaultSwapGrace.
+func GetSwappableProvider(section ConfigSection) *ioc.Provider[*ioc.Swappable[*redis.Client]] {
+	return swappableProviders.GetProvider(string(section), func(c *ioc.Container) (*ioc.Swappable[*redis.Client], error) {
+		return ioc.WatchSwappable(c, string(section), defaultConfigData, ioc.DefaultSwapGrace, func(cfg *Config) (*redis.Client, func() error, error) {
+			client, err := cfg.newClient(ioc.GetLogger(c, "database/redis"))
+			if err != nil {
+				return nil, nil, err
+			}
+			return client, client.Close, nil
+		})
+	})
+}
+
+func GetSwappableRedis(c *ioc.Container) *ioc.Swappable[*redis.Client] {
+	config := DefaultConfigSection
+	client, err := GetSwappableProvider(config).Get(c)
+	if err != nil {
+		panic(fmt.Errorf("get swappable redis client \"%s\": %w", config, err))
+	}
+	return client
+}
@@ -0,0 +1,37 @@
+package redis
+
+import (
+	"context"
+	"github.com/aiechoic/services/ioc"
+	"github.com/redis/go-redis/v9"
+)
+
+type kvStore struct {
+	client redis.UniversalClient
+}
+
+// NewConfigSource returns a config source reading each section from the
+// redis string key "<prefix><section>", holding a JSON, YAML or TOML
+// document:
+//
+//	SET config:email-sender '{"port": "587"}'
+func NewConfigSource(client redis.UniversalClient, prefix string) ioc.ConfigSource {
+	return ioc.NewKVSource(&kvStore{client: client}, prefix)
+}
+
+func (s *kvStore) List(ctx context.Context, prefix string) (map[string][]byte, error) {
+	values := map[string][]byte{}
+	iter := s.client.Scan(ctx, 0, prefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		data, err := s.client.Get(ctx, key).Bytes()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[key] = data
+	}
+	return values, iter.Err()
+}
@@ -48,6 +48,15 @@ type PusherConfig struct {
 	Levels map[healthy.Level]int64 `mapstructure:"levels"`
 }
 
+func (c *PusherConfig) Validate() error {
+	for level, n := range c.Levels {
+		if n < 0 {
+			return fmt.Errorf("levels.%s must not be negative", level)
+		}
+	}
+	return nil
+}
+
 func (c *PusherConfig) GetError(queueLength int64) *healthy.Error {
 	var levels = []healthy.Level{healthy.LFatal, healthy.LError, healthy.LWarn, healthy.LInfo, healthy.LDebug}
 	for _, level := range levels {
@@ -70,3 +79,10 @@ type SenderConfig struct {
 	Template string `mapstructure:"template"`
 	Subject  string `mapstructure:"subject"`
 }
+
+func (c *SenderConfig) Validate() error {
+	if c.From == "" || c.Host == "" || c.Port == "" {
+		return fmt.Errorf("from, host and port are required")
+	}
+	return nil
+}
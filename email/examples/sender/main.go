@@ -10,19 +10,18 @@ import (
 func main() {
 
 	c := ioc.NewContainer()
-	defer c.Close()
 
 	err := c.LoadConfig("./configs", ioc.ConfigEnvTest)
 	if err != nil {
 		panic(err)
 	}
 
-	sender := email.GetSender(c)
+	// the sender checks the email message queue and sends emails
+	// once the container is running
+	email.GetSender(c).Start(c)
 
-	ctx := context.Background()
-
-	// start checking email message queue, and send email
-	sender.Run(ctx, func(err error) {
+	err = c.Run(context.Background())
+	if err != nil {
 		log.Println(err)
-	})
+	}
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/aiechoic/services/email"
 	"github.com/aiechoic/services/email/verify"
@@ -76,7 +77,6 @@ var indexHTML = `
 func main() {
 	addr := ":8866"
 	c := ioc.NewContainer()
-	defer c.Close()
 
 	err := c.LoadConfig("./configs", ioc.ConfigEnvTest)
 	if err != nil {
@@ -132,30 +132,32 @@ func main() {
 	})
 
 	// start checking email message queue, and send email, you can run this in another program
-	go RunSender(c)
+	email.GetSender(c).Start(c)
 
 	// start health check
 	go RunHealthCheck(c)
 
+	c.OnStart(func(ctx context.Context) error {
+		srv := &http.Server{Addr: addr}
+		go func() {
+			<-ctx.Done()
+			_ = srv.Close()
+		}()
+		err := srv.ListenAndServe()
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	})
+
 	fmt.Printf("server started at http://localhost%s\n\n", addr)
 
-	err = http.ListenAndServe(addr, nil)
+	err = c.Run(context.Background())
 	if err != nil {
 		log.Fatalf("http server error: %v", err)
 	}
 }
 
-func RunSender(c *ioc.Container) {
-	sender := email.GetSender(c)
-
-	ctx := context.Background()
-
-	// start checking email message queue, and send email
-	sender.Run(ctx, func(err error) {
-		log.Println(err)
-	})
-}
-
 func RunHealthCheck(c *ioc.Container) {
 	ticker := 20 * time.Second
 	checkTimeout := 5 * time.Second
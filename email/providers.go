@@ -7,9 +7,7 @@ import (
 	"github.com/aiechoic/services/ioc"
 	"github.com/aiechoic/services/ioc/healthy"
 	"github.com/aiechoic/services/message/queue"
-	"github.com/spf13/viper"
-	"log"
-	"sync"
+	"sync/atomic"
 )
 
 const (
@@ -26,6 +24,13 @@ var (
 	pusherProviders = ioc.NewProviders[*Pusher]()
 )
 
+func init() {
+	ioc.RegisterDefaultConfig(string(DefaultSenderConfigSection), defaultSenderConfigData)
+	ioc.RegisterDefaultConfig(string(DefaultPusherConfigSection), defaultPusherConfigData)
+	ioc.RegisterConfigType(string(DefaultSenderConfigSection), SenderConfig{})
+	ioc.RegisterConfigType(string(DefaultPusherConfigSection), PusherConfig{})
+}
+
 type SenderConfigSection string
 type PusherConfigSection string
 type RedisQueueKey string
@@ -45,20 +50,7 @@ func GetSenderProvider(
 	return senderProviders.GetProvider(string(senderConfig), func(c *ioc.Container) (*Sender, error) {
 		rdsQueue := getRedisQueueProvider(redisConfig, redisKey).MustGet(c)
 		sender := NewSender(rdsQueue)
-		err := c.UnmarshalAndWatchConfig(string(senderConfig), defaultSenderConfigData, func(v *viper.Viper) {
-			var cfg SenderConfig
-			err := v.Unmarshal(&cfg)
-			if err != nil {
-				log.Println(err)
-				return
-			}
-			err = sender.UpdateConfig(&cfg)
-			if err != nil {
-				log.Printf("update sender config \"%s\"error: %v\n", senderConfig, err)
-				return
-			}
-			log.Printf("loaded sender config \"%s\"success\n", senderConfig)
-		})
+		err := ioc.WatchTyped(c, string(senderConfig), defaultSenderConfigData, sender.UpdateConfig)
 		if err != nil {
 			return nil, err
 		}
@@ -66,6 +58,19 @@ func GetSenderProvider(
 	})
 }
 
+// Start registers the sending loop of s as a worker of c, run while c.Run
+// runs. The provider does not start the loop itself, so call it once per
+// sender.
+func (s *Sender) Start(c *ioc.Container) {
+	c.OnStart(func(ctx context.Context) error {
+		logger := ioc.GetLogger(c, "email")
+		s.Run(ctx, func(err error) {
+			logger.Error("send email error", "error", err)
+		})
+		return nil
+	})
+}
+
 func GetSender(c *ioc.Container) *Sender {
 	return GetSenderProvider(
 		DefaultSenderConfigSection,
@@ -81,24 +86,15 @@ func GetPusherProvider(
 ) *ioc.Provider[*Pusher] {
 	return pusherProviders.GetProvider(string(pusherConfig), func(c *ioc.Container) (*Pusher, error) {
 		var rdsQueue = getRedisQueueProvider(redisConfig, redisKey).MustGet(c)
-		var cfg = &PusherConfig{}
-		var mu = &sync.Mutex{}
-		err := c.UnmarshalAndWatchConfig(string(pusherConfig), defaultPusherConfigData, func(v *viper.Viper) {
-			mu.Lock()
-			defer mu.Unlock()
-			err := v.Unmarshal(cfg)
-			if err != nil {
-				log.Println(err)
-				return
-			}
-			log.Printf("loaded pusher config \"%s\"success\n", pusherConfig)
+		var cfg atomic.Pointer[PusherConfig]
+		err := ioc.WatchTyped(c, string(pusherConfig), defaultPusherConfigData, func(newCfg *PusherConfig) error {
+			cfg.Store(newCfg)
+			return nil
 		})
 		if err != nil {
 			return nil, err
 		}
-		c.OnHealthCheck(func() *healthy.Error {
-			mu.Lock()
-			defer mu.Unlock()
+		c.OnNamedHealthCheck(string(pusherConfig), func() *healthy.Error {
 			n, err := rdsQueue.Len(context.Background())
 			if err != nil {
 				return &healthy.Error{
@@ -106,7 +102,7 @@ func GetPusherProvider(
 					Msg:   err.Error(),
 				}
 			}
-			return cfg.GetError(n)
+			return cfg.Load().GetError(n)
 		})
 		return NewPusher(rdsQueue), nil
 	})
@@ -1,6 +1,7 @@
 package verify
 
 import (
+	"fmt"
 	"time"
 )
 
@@ -17,9 +18,9 @@ random_chars: "0123456789"
 code_length: 6
 # cache expire time in seconds
 cache_expire_in_seconds: 60
-# rate limit every n times in m seconds
-rate_limit_every_in_seconds: m
-rate_limit_allow_n: n
+# rate limit: allow n codes every m seconds
+rate_limit_every_in_seconds: 60
+rate_limit_allow_n: 1
 `)
 
 var defaultTemplateData = []byte(
@@ -45,6 +46,19 @@ type Config struct {
 	RateLimitAllowN         int    `mapstructure:"rate_limit_allow_n"`
 }
 
+func (c *Config) Validate() error {
+	if c.CodeLength < 0 {
+		return fmt.Errorf("code_length must not be negative")
+	}
+	if c.CacheExpireInSeconds <= 0 {
+		return fmt.Errorf("cache_expire_in_seconds must be positive")
+	}
+	if c.RateLimitEveryInSeconds <= 0 || c.RateLimitAllowN <= 0 {
+		return fmt.Errorf("rate_limit_every_in_seconds and rate_limit_allow_n must be positive")
+	}
+	return nil
+}
+
 func (c *Config) ToOptions() *GeneratorOptions {
 	return &GeneratorOptions{
 		RandomChars:     c.RandomChars,
@@ -6,9 +6,6 @@ import (
 	"github.com/aiechoic/services/encoding"
 	"github.com/aiechoic/services/ioc"
 	"github.com/aiechoic/services/rate"
-	"github.com/spf13/viper"
-	"log"
-	"sync"
 )
 
 var DefaultConfigSection ConfigSection = "verify-code-generator"
@@ -21,6 +18,11 @@ type RedisCodeKey string
 
 var generatorProviders = ioc.NewProviders[*Generator]()
 
+func init() {
+	ioc.RegisterDefaultConfig(string(DefaultConfigSection), defaultConfigData)
+	ioc.RegisterConfigType(string(DefaultConfigSection), Config{})
+}
+
 func GetGeneratorProvider(
 	configSection ConfigSection,
 	pusherConfig email.PusherConfigSection,
@@ -33,22 +35,8 @@ func GetGeneratorProvider(
 		rds := redis.GetProvider(redisConfig).MustGet(c)
 		storage := rate.NewRedisStorage[string](rds, encoding.JSONSerializer, string(redisCodeKey))
 		generator := NewGenerator(storage, pusher)
-		mu := &sync.Mutex{}
-		err := c.UnmarshalAndWatchConfig(string(configSection), defaultConfigData, func(v *viper.Viper) {
-			mu.Lock()
-			defer mu.Unlock()
-			var cfg Config
-			err := v.Unmarshal(&cfg)
-			if err != nil {
-				log.Println(err)
-				return
-			}
-			err = generator.UpdateConfig(cfg.ToOptions())
-			if err != nil {
-				log.Printf("update generator config \"%s\"error: %v\n", configSection, err)
-				return
-			}
-			log.Printf("loaded generator config \"%s\"success\n", configSection)
+		err := ioc.WatchTyped(c, string(configSection), defaultConfigData, func(cfg *Config) error {
+			return generator.UpdateConfig(cfg.ToOptions())
 		})
 		if err != nil {
 			return nil, err
@@ -1,9 +1,12 @@
 package gins
 
 import (
+	"github.com/aiechoic/services/ioc"
+	"github.com/aiechoic/services/ioc/healthy"
 	"github.com/aiechoic/services/openapi"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"log/slog"
 	"os"
 	"path"
 )
@@ -36,6 +39,26 @@ static_routes: []
 #  - route: "/static"
 #    dir: "./static"
 #    not_found: "404.html" # "index.html" for vuejs
+# liveness and readiness endpoints backed by the container health checks
+health:
+  # enable the health endpoints
+  enable: true
+  # liveness probe path
+  liveness_path: "/healthz"
+  # readiness probe path
+  readiness_path: "/readyz"
+  # timeout of the health checks in milliseconds
+  timeout_ms: 3000
+  # lowest level that fails the liveness probe, can be "debug", "info", "warn", "error", "fatal"
+  liveness_level: "fatal"
+  # lowest level that fails the readiness probe
+  readiness_level: "error"
+# prometheus metrics of the ioc container
+metrics:
+  # enable the metrics endpoint
+  enable: false
+  # metrics path
+  path: "/metrics"
 `)
 
 type OpenAPIServer struct {
@@ -50,6 +73,20 @@ type StaticRoute struct {
 	NotFound string `mapstructure:"not_found"`
 }
 
+type HealthConfig struct {
+	Enable         bool          `mapstructure:"enable"`
+	LivenessPath   string        `mapstructure:"liveness_path"`
+	ReadinessPath  string        `mapstructure:"readiness_path"`
+	TimeoutMs      int           `mapstructure:"timeout_ms"`
+	LivenessLevel  healthy.Level `mapstructure:"liveness_level"`
+	ReadinessLevel healthy.Level `mapstructure:"readiness_level"`
+}
+
+type MetricsConfig struct {
+	Enable bool   `mapstructure:"enable"`
+	Path   string `mapstructure:"path"`
+}
+
 type Config struct {
 	ApiTitle     string          `mapstructure:"api_title"`   // for openapi
 	ApiVersion   string          `mapstructure:"api_version"` // for openapi
@@ -60,26 +97,47 @@ type Config struct {
 	EnableCORS   bool            `mapstructure:"enable_cors"`
 	APIRoot      string          `mapstructure:"api_root"`
 	StaticRoutes []StaticRoute   `mapstructure:"static_routes"`
+	Health       HealthConfig    `mapstructure:"health"`
+	Metrics      MetricsConfig   `mapstructure:"metrics"`
 }
 
 func (c *Config) NewServer() *Server {
-	engine, router := c.NewEngine()
+	return c.newServer(nil)
+}
+
+// newServer returns a server logging with the logger of container, or with
+// slog.Default and the gin request logger when container is nil.
+func (c *Config) newServer(container *ioc.Container) *Server {
+	engine, router := c.newEngine(container)
 	api := c.NewOpenAPI()
+	logger := slog.Default()
+	if container != nil {
+		logger = ioc.GetLogger(container, "gins")
+	}
 	return &Server{
 		API:       api,
 		Port:      c.HttpPort,
 		Engine:    engine,
 		APIRouter: router,
+		Logger:    logger,
 	}
 }
 
 func (g *Config) NewEngine() (*gin.Engine, gin.IRouter) {
+	return g.newEngine(nil)
+}
+
+func (g *Config) newEngine(c *ioc.Container) (*gin.Engine, gin.IRouter) {
 	if g.GinMode == "" {
 		gin.SetMode(g.GinMode)
 	}
 	r := gin.New()
 	if g.Log {
-		r.Use(gin.Logger())
+		if c != nil {
+			r.Use(Logger(c))
+		} else {
+			r.Use(gin.Logger())
+		}
 	}
 	r.Use(gin.Recovery())
 	if g.EnableCORS {
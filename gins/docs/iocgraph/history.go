@@ -0,0 +1,48 @@
+package iocgraph
+
+import (
+	"fmt"
+	"github.com/aiechoic/services/gins"
+	"github.com/aiechoic/services/ioc"
+	"github.com/gin-gonic/gin"
+	"strconv"
+	"time"
+)
+
+// ServeConfigHistory serves the recent changes of the config sections of c
+// as JSON. The optional query parameters section, key, since (RFC 3339) and
+// limit filter them.
+func ServeConfigHistory(s *gins.Server, c *ioc.Container) {
+	s.Engine.GET("/ioc-config-history.json", func(ctx *gin.Context) {
+		q := ioc.ConfigHistoryQuery{
+			Section: ctx.Query("section"),
+			Key:     ctx.Query("key"),
+		}
+		var err error
+		if since := ctx.Query("since"); since != "" {
+			q.Since, err = time.Parse(time.RFC3339, since)
+			if err != nil {
+				ctx.JSON(400, gin.H{"error": fmt.Sprintf("invalid since: %v", err)})
+				return
+			}
+		}
+		if limit := ctx.Query("limit"); limit != "" {
+			q.Limit, err = strconv.Atoi(limit)
+			if err != nil {
+				ctx.JSON(400, gin.H{"error": fmt.Sprintf("invalid limit: %v", err)})
+				return
+			}
+		}
+		changes, err := c.ConfigHistory(q)
+		if err != nil {
+			_ = ctx.AbortWithError(500, err)
+			return
+		}
+		if changes == nil {
+			changes = []*ioc.ConfigChange{}
+		}
+		ctx.JSON(200, changes)
+	})
+
+	fmt.Printf("serve ioc config history at http://localhost:%d/ioc-config-history.json\n", s.Port)
+}
@@ -0,0 +1,25 @@
+package iocgraph
+
+import (
+	"fmt"
+	"github.com/aiechoic/services/gins"
+	"github.com/aiechoic/services/ioc"
+	"github.com/gin-gonic/gin"
+)
+
+// ServeGraph serves the dependency graph of c as JSON and Graphviz DOT.
+func ServeGraph(s *gins.Server, c *ioc.Container) {
+	s.Engine.GET("/ioc-graph.json", func(ctx *gin.Context) {
+		data, err := c.Graph().JSON()
+		if err != nil {
+			_ = ctx.AbortWithError(500, err)
+			return
+		}
+		ctx.Data(200, "application/json; charset=utf-8", data)
+	})
+	s.Engine.GET("/ioc-graph.dot", func(ctx *gin.Context) {
+		ctx.Data(200, "text/vnd.graphviz; charset=utf-8", []byte(c.Graph().DOT()))
+	})
+
+	fmt.Printf("serve ioc graph at http://localhost:%d/ioc-graph.json\n", s.Port)
+}
@@ -3,17 +3,28 @@ package main
 import (
 	"context"
 	"github.com/aiechoic/services/gins"
+	"github.com/aiechoic/services/gins/docs/iocgraph"
 	"github.com/aiechoic/services/gins/docs/redoc"
 	"github.com/aiechoic/services/gins/docs/swagger"
 	"github.com/aiechoic/services/gins/example/user"
 	"github.com/aiechoic/services/ioc"
+	"github.com/spf13/pflag"
+	"log"
 )
 
 func main() {
 	secret := "secret"
 	c := ioc.NewContainer()
-	defer c.Close()
-	err := c.LoadConfig("./configs", ioc.ConfigEnvTest)
+
+	// e.g. --gin-service.http_port=9090
+	ioc.BindConfigFlags(pflag.CommandLine)
+	pflag.Parse()
+	err := c.SetConfigFlags(pflag.CommandLine)
+	if err != nil {
+		panic(err)
+	}
+
+	err = c.LoadConfig("./configs", ioc.ConfigEnvTest)
 	if err != nil {
 		panic(err)
 	}
@@ -30,5 +41,18 @@ func main() {
 
 	swagger.ServeAPI(server)
 
-	server.Run(context.Background())
+	iocgraph.ServeGraph(server, c)
+	iocgraph.ServeConfigHistory(server, c)
+
+	err = c.Validate(context.Background())
+	if err != nil {
+		panic(err)
+	}
+
+	server.Start(c)
+
+	err = c.Run(context.Background())
+	if err != nil {
+		log.Println(err)
+	}
 }
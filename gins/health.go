@@ -0,0 +1,63 @@
+package gins
+
+import (
+	"context"
+	"github.com/aiechoic/services/ioc"
+	"github.com/aiechoic/services/ioc/healthy"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+type HealthCheck struct {
+	*healthy.Report
+	Failing bool `json:"failing"`
+}
+
+type HealthResponse struct {
+	Status string         `json:"status"`
+	Checks []*HealthCheck `json:"checks"`
+}
+
+// ServeHealth mounts the liveness and readiness endpoints. Each request
+// runs the health checks of c and lists their reports; the endpoint answers
+// 503 when a check fails at or above the configured level, 200 otherwise.
+func (s *Server) ServeHealth(c *ioc.Container, cfg *HealthConfig) {
+	timeout := time.Duration(cfg.TimeoutMs) * time.Millisecond
+	if cfg.LivenessPath != "" {
+		s.Engine.GET(cfg.LivenessPath, healthHandler(c, timeout, cfg.LivenessLevel))
+	}
+	if cfg.ReadinessPath != "" {
+		s.Engine.GET(cfg.ReadinessPath, healthHandler(c, timeout, cfg.ReadinessLevel))
+	}
+}
+
+func healthHandler(c *ioc.Container, timeout time.Duration, level healthy.Level) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		checkCtx := context.Context(ctx.Request.Context())
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			checkCtx, cancel = context.WithTimeout(checkCtx, timeout)
+			defer cancel()
+		}
+		resp := &HealthResponse{
+			Status: "ok",
+			Checks: []*HealthCheck{},
+		}
+		for _, r := range c.CheckHealthReports(checkCtx) {
+			failing := r.Status != healthy.StatusOK && r.Level.Number() >= level.Number()
+			if failing {
+				resp.Status = "fail"
+			}
+			resp.Checks = append(resp.Checks, &HealthCheck{
+				Report:  r,
+				Failing: failing,
+			})
+		}
+		code := http.StatusOK
+		if resp.Status != "ok" {
+			code = http.StatusServiceUnavailable
+		}
+		ctx.JSON(code, resp)
+	}
+}
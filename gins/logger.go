@@ -0,0 +1,74 @@
+package gins
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/aiechoic/services/ioc"
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"time"
+)
+
+const (
+	loggerKey       = "ioc-logger"
+	RequestIDHeader = "X-Request-Id"
+)
+
+// Logger returns a middleware logging every request with the logger of c.
+// The request logger carries the request id, taken from the X-Request-Id
+// header or generated, the method, the path and the client ip; handlers
+// get it with GetLogger and add attributes with WithLogAttrs.
+func Logger(c *ioc.Container) gin.HandlerFunc {
+	base := ioc.GetLogger(c, "gins")
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		id := ctx.GetHeader(RequestIDHeader)
+		if id == "" {
+			id = newRequestID()
+		}
+		ctx.Header(RequestIDHeader, id)
+		ctx.Set(loggerKey, base.With(
+			"request_id", id,
+			"method", ctx.Request.Method,
+			"path", ctx.Request.URL.Path,
+			"client_ip", ctx.ClientIP(),
+		))
+
+		ctx.Next()
+
+		logger := GetLogger(ctx)
+		attrs := []any{"status", ctx.Writer.Status(), "latency", time.Since(start)}
+		if len(ctx.Errors) > 0 {
+			attrs = append(attrs, "error", ctx.Errors.String())
+		}
+		switch status := ctx.Writer.Status(); {
+		case status >= 500:
+			logger.ErrorContext(ctx, "request", attrs...)
+		case status >= 400:
+			logger.WarnContext(ctx, "request", attrs...)
+		default:
+			logger.InfoContext(ctx, "request", attrs...)
+		}
+	}
+}
+
+// GetLogger returns the request logger set by the Logger middleware, or
+// slog.Default without it.
+func GetLogger(ctx *gin.Context) *slog.Logger {
+	if logger, ok := ctx.Get(loggerKey); ok {
+		return logger.(*slog.Logger)
+	}
+	return slog.Default()
+}
+
+// WithLogAttrs adds attributes, such as the authenticated user, to the
+// request logger and to the request log line.
+func WithLogAttrs(ctx *gin.Context, args ...any) {
+	ctx.Set(loggerKey, GetLogger(ctx).With(args...))
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
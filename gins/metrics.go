@@ -0,0 +1,27 @@
+package gins
+
+import (
+	"fmt"
+	"github.com/aiechoic/services/ioc"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// ServeMetrics serves the metrics of c at path in the Prometheus text format.
+// It serves the metrics already set on c, which must then be an http.Handler
+// such as ioc.PrometheusMetrics; otherwise it records them from now on, so
+// set them before resolving providers to count every build.
+func (s *Server) ServeMetrics(c *ioc.Container, path string) error {
+	m := c.Metrics()
+	if m == nil {
+		pm := ioc.NewPrometheusMetrics()
+		c.SetMetrics(pm)
+		m = pm
+	}
+	h, ok := m.(http.Handler)
+	if !ok {
+		return fmt.Errorf("cannot serve metrics of type %T", m)
+	}
+	s.Engine.GET(path, gin.WrapH(h))
+	return nil
+}
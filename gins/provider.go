@@ -8,6 +8,11 @@ type ConfigSection string
 
 var providers = ioc.NewProviders[*Server]()
 
+func init() {
+	ioc.RegisterDefaultConfig(string(DefaultConfigSection), defaultConfigData)
+	ioc.RegisterConfigType(string(DefaultConfigSection), Config{})
+}
+
 func GetServerByConfig(configSection ConfigSection, c *ioc.Container) *Server {
 	pvd := providers.GetProvider(string(configSection), func(c *ioc.Container) (*Server, error) {
 		var cfg Config
@@ -15,7 +20,17 @@ func GetServerByConfig(configSection ConfigSection, c *ioc.Container) *Server {
 		if err != nil {
 			return nil, err
 		}
-		return cfg.NewServer(), nil
+		server := cfg.newServer(c)
+		if cfg.Health.Enable {
+			server.ServeHealth(c, &cfg.Health)
+		}
+		if cfg.Metrics.Enable {
+			err = server.ServeMetrics(c, cfg.Metrics.Path)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return server, nil
 	})
 	return pvd.MustGet(c)
 }
@@ -0,0 +1,32 @@
+package gins
+
+import (
+	"github.com/aiechoic/services/ioc"
+	"github.com/gin-gonic/gin"
+)
+
+const scopeKey = "ioc-scope"
+
+// Scope returns a middleware that opens a child scope of c for every
+// request and closes it once the request has been handled.
+func Scope(c *ioc.Container) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		scope := c.NewScope()
+		defer func() {
+			if err := scope.Close(); err != nil {
+				GetLogger(ctx).Error("close request scope error", "error", err)
+			}
+		}()
+		ctx.Set(scopeKey, scope)
+		ctx.Next()
+	}
+}
+
+// GetScope returns the request scope opened by the Scope middleware.
+func GetScope(ctx *gin.Context) *ioc.Container {
+	scope, ok := ctx.Get(scopeKey)
+	if !ok {
+		panic("gins: no ioc scope in context, use the gins.Scope middleware")
+	}
+	return scope.(*ioc.Container)
+}
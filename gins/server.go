@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/aiechoic/services/ioc"
 	"github.com/aiechoic/services/openapi"
 	"github.com/gin-gonic/gin"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -21,38 +23,71 @@ type Server struct {
 	Port      int
 	Engine    *gin.Engine
 	APIRouter gin.IRouter
+	Logger    *slog.Logger
 }
 
+func (s *Server) logger() *slog.Logger {
+	if s.Logger == nil {
+		return slog.Default()
+	}
+	return s.Logger
+}
+
+// Run serves until ctx is cancelled or the process receives SIGINT or
+// SIGTERM. Use Serve when the server is managed by an ioc.Container.
 func (s *Server) Run(ctx context.Context) {
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := s.Serve(ctx); err != nil {
+		s.logger().Error("server error", "error", err)
+		os.Exit(1)
+	}
+
+	s.logger().Info("server exiting")
+}
+
+// Start registers s as a worker of c, served while c.Run runs. The provider
+// does not start the server itself, so call it once per server.
+func (s *Server) Start(c *ioc.Container) {
+	c.OnStart(s.Serve)
+}
+
+// Serve listens on the configured port until ctx is cancelled, then shuts
+// the server down gracefully. Failing to listen is an ioc.Fatal error, so
+// that ioc.Container.Run stops instead of restarting the server.
+func (s *Server) Serve(ctx context.Context) error {
 	address := fmt.Sprintf(":%d", s.Port)
 	srv := &http.Server{
 		Addr:    address,
 		Handler: s.Engine,
 	}
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return ioc.Fatal(fmt.Errorf("listen: %w", err))
+	}
 
+	errChan := make(chan error, 1)
 	go func() {
-		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Fatalf("listen: %s\n", err)
-		}
+		errChan <- srv.Serve(ln)
 	}()
 
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-
 	select {
-	case <-quit:
-		log.Println("received system signal, shutting down gracefully")
+	case err := <-errChan:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return fmt.Errorf("serve: %w", err)
 	case <-ctx.Done():
-		log.Println("context cancelled, shutting down gracefully")
+		s.logger().Info("context cancelled, shutting down gracefully")
 	}
 
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := srv.Shutdown(shutdownCtx); err != nil {
-		log.Fatal("server forced to shutdown:", err)
+		return fmt.Errorf("server forced to shutdown: %w", err)
 	}
-
-	log.Println("server exiting")
+	return nil
 }
 
 func (s *Server) Register(services ...*Service) {
@@ -0,0 +1,197 @@
+package ioc
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// configHistorySize is the number of section changes Vipers keeps.
+const configHistorySize = 256
+
+type ConfigChangeKind string
+
+const (
+	ConfigKeyAdded   ConfigChangeKind = "added"
+	ConfigKeyRemoved ConfigChangeKind = "removed"
+	ConfigKeyChanged ConfigChangeKind = "changed"
+)
+
+// ConfigKeyChange is the change of one key of a section. Secret values are
+// redacted.
+type ConfigKeyChange struct {
+	Key    string           `json:"key"`
+	Kind   ConfigChangeKind `json:"kind"`
+	Old    any              `json:"old,omitempty"`
+	New    any              `json:"new,omitempty"`
+	Origin string           `json:"origin,omitempty"` // file or source setting the key
+}
+
+// ConfigChange is a reload of a section that changed some of its keys.
+type ConfigChange struct {
+	Section string            `json:"section"`
+	Time    time.Time         `json:"time"`
+	Keys    []ConfigKeyChange `json:"keys"`
+}
+
+func (c *ConfigChange) String() string {
+	parts := make([]string, len(c.Keys))
+	for i, k := range c.Keys {
+		switch k.Kind {
+		case ConfigKeyAdded:
+			parts[i] = fmt.Sprintf("+%s=%v", k.Key, k.New)
+		case ConfigKeyRemoved:
+			parts[i] = fmt.Sprintf("-%s", k.Key)
+		default:
+			parts[i] = fmt.Sprintf("%s: %v -> %v", k.Key, k.Old, k.New)
+		}
+		if k.Origin != "" {
+			parts[i] += fmt.Sprintf(" (%s)", k.Origin)
+		}
+	}
+	return fmt.Sprintf("config \"%s\" changed: %s", c.Section, strings.Join(parts, ", "))
+}
+
+// AuditSink receives the changes of the config sections, for example to
+// forward them to a log pipeline or a database.
+type AuditSink interface {
+	Record(change *ConfigChange)
+}
+
+// AuditSinkFunc adapts a function to AuditSink.
+type AuditSinkFunc func(change *ConfigChange)
+
+func (f AuditSinkFunc) Record(change *ConfigChange) {
+	f(change)
+}
+
+// ConfigHistoryQuery selects changes from the history. Zero fields match
+// every change.
+type ConfigHistoryQuery struct {
+	Section string
+	Key     string // key, or parent of the keys, that changed
+	Since   time.Time
+	Limit   int // most recent changes kept when positive
+}
+
+type configAudit struct {
+	history []*ConfigChange
+	sinks   []AuditSink
+	mu      sync.Mutex
+}
+
+// AddAuditSink sends each future change of a section to sink.
+func (c *Vipers) AddAuditSink(sink AuditSink) {
+	c.audit.mu.Lock()
+	defer c.audit.mu.Unlock()
+	c.audit.sinks = append(c.audit.sinks, sink)
+}
+
+// History returns the recorded changes matching q, oldest first.
+func (c *Vipers) History(q ConfigHistoryQuery) []*ConfigChange {
+	c.audit.mu.Lock()
+	defer c.audit.mu.Unlock()
+	var changes []*ConfigChange
+	for _, ch := range c.audit.history {
+		if q.Section != "" && ch.Section != q.Section {
+			continue
+		}
+		if !q.Since.IsZero() && ch.Time.Before(q.Since) {
+			continue
+		}
+		if q.Key != "" {
+			keys := make([]ConfigKeyChange, 0, len(ch.Keys))
+			for _, k := range ch.Keys {
+				if k.Key == q.Key || strings.HasPrefix(k.Key, q.Key+".") || strings.HasPrefix(k.Key, q.Key+"[") {
+					keys = append(keys, k)
+				}
+			}
+			if len(keys) == 0 {
+				continue
+			}
+			ch = &ConfigChange{Section: ch.Section, Time: ch.Time, Keys: keys}
+		}
+		changes = append(changes, ch)
+	}
+	if q.Limit > 0 && len(changes) > q.Limit {
+		changes = changes[len(changes)-q.Limit:]
+	}
+	return changes
+}
+
+func (a *configAudit) record(logger *slog.Logger, change *ConfigChange) {
+	logger.Info(change.String(), "section", change.Section)
+	a.mu.Lock()
+	a.history = append(a.history, change)
+	if len(a.history) > configHistorySize {
+		a.history = a.history[len(a.history)-configHistorySize:]
+	}
+	sinks := append([]AuditSink(nil), a.sinks...)
+	a.mu.Unlock()
+	for _, s := range sinks {
+		s.Record(change)
+	}
+}
+
+// diffSettings returns the change from old to new settings of section, with
+// the values of secretKeys and of keys naming credentials redacted.
+func diffSettings(section string, old, new map[string]any, secretKeys []string, origins map[string]string) *ConfigChange {
+	oldLeaves, newLeaves := map[string]any{}, map[string]any{}
+	flattenSettings(old, "", oldLeaves)
+	flattenSettings(new, "", newLeaves)
+	secret := func(key string) bool {
+		for _, s := range secretKeys {
+			if s == key || strings.HasPrefix(s, key+"[") {
+				return true
+			}
+		}
+		return isSecretKey(key)
+	}
+	value := func(key string, v any) any {
+		if secret(key) {
+			return redacted
+		}
+		return v
+	}
+
+	change := &ConfigChange{Section: section, Time: time.Now()}
+	for k, nv := range newLeaves {
+		ov, ok := oldLeaves[k]
+		switch {
+		case !ok:
+			change.Keys = append(change.Keys, ConfigKeyChange{
+				Key: k, Kind: ConfigKeyAdded, New: value(k, nv), Origin: keyOrigin(origins, k),
+			})
+		case !reflect.DeepEqual(ov, nv):
+			change.Keys = append(change.Keys, ConfigKeyChange{
+				Key: k, Kind: ConfigKeyChanged, Old: value(k, ov), New: value(k, nv), Origin: keyOrigin(origins, k),
+			})
+		}
+	}
+	for k, ov := range oldLeaves {
+		if _, ok := newLeaves[k]; !ok {
+			change.Keys = append(change.Keys, ConfigKeyChange{Key: k, Kind: ConfigKeyRemoved, Old: value(k, ov)})
+		}
+	}
+	sort.Slice(change.Keys, func(i, j int) bool {
+		return change.Keys[i].Key < change.Keys[j].Key
+	})
+	return change
+}
+
+// flattenSettings stores the leaves of settings in out by lowercase dotted
+// key.
+func flattenSettings(settings map[string]any, prefix string, out map[string]any) {
+	for k, v := range settings {
+		key := joinKey(prefix, strings.ToLower(k))
+		if m, ok := v.(map[string]any); ok {
+			flattenSettings(m, key, out)
+			continue
+		}
+		out[key] = v
+	}
+}
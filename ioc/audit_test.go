@@ -0,0 +1,72 @@
+package ioc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVipers_Audit(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "limits.test.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("rate: 10\nburst: 5\npassword: p1\n"), 0644))
+
+	vipers, err := NewVipers(dir, ConfigEnvTest)
+	assert.NoError(t, err)
+	defer vipers.Close()
+
+	recorded := make(chan *ConfigChange, 4)
+	vipers.AddAuditSink(AuditSinkFunc(func(change *ConfigChange) {
+		recorded <- change
+	}))
+	assert.NoError(t, vipers.WatchConfig("limits", func(*viper.Viper) {}))
+
+	start := time.Now()
+	assert.NoError(t, os.WriteFile(file, []byte("rate: 20\npassword: p2\nwindow: 1m\n"), 0644))
+	first := waitFor(t, recorded)
+
+	history := vipers.History(ConfigHistoryQuery{})
+	if assert.Len(t, history, 1) {
+		change := history[0]
+		assert.Equal(t, "limits", change.Section)
+		assert.Equal(t, []ConfigKeyChange{
+			{Key: "burst", Kind: ConfigKeyRemoved, Old: 5},
+			{Key: "password", Kind: ConfigKeyChanged, Old: redacted, New: redacted, Origin: file},
+			{Key: "rate", Kind: ConfigKeyChanged, Old: 10, New: 20, Origin: file},
+			{Key: "window", Kind: ConfigKeyAdded, New: "1m", Origin: file},
+		}, change.Keys)
+	}
+	assert.Equal(t, history, []*ConfigChange{first})
+
+	assert.NoError(t, os.WriteFile(file, []byte("rate: 30\npassword: p2\nwindow: 1m\n"), 0644))
+	waitFor(t, recorded)
+
+	assert.Len(t, vipers.History(ConfigHistoryQuery{Section: "limits", Since: start}), 2)
+	assert.Empty(t, vipers.History(ConfigHistoryQuery{Section: "other"}))
+	assert.Empty(t, vipers.History(ConfigHistoryQuery{Since: time.Now()}))
+
+	rates := vipers.History(ConfigHistoryQuery{Key: "rate"})
+	if assert.Len(t, rates, 2) {
+		assert.Equal(t, []ConfigKeyChange{{Key: "rate", Kind: ConfigKeyChanged, Old: 10, New: 20, Origin: file}}, rates[0].Keys)
+	}
+	assert.Len(t, vipers.History(ConfigHistoryQuery{Key: "window"}), 1)
+
+	last := vipers.History(ConfigHistoryQuery{Limit: 1})
+	if assert.Len(t, last, 1) {
+		assert.Equal(t, 30, last[0].Keys[0].New)
+	}
+}
+
+func TestDiffSettings_Nested(t *testing.T) {
+	old := map[string]any{"smtp": map[string]any{"host": "a", "token": "t1"}}
+	new := map[string]any{"smtp": map[string]any{"host": "b", "token": "t1", "key": "k"}}
+	change := diffSettings("email", old, new, []string{"smtp.key"}, nil)
+	assert.Equal(t, []ConfigKeyChange{
+		{Key: "smtp.host", Kind: ConfigKeyChanged, Old: "a", New: "b"},
+		{Key: "smtp.key", Kind: ConfigKeyAdded, New: redacted},
+	}, change.Keys)
+}
@@ -4,92 +4,360 @@ import (
 	"context"
 	"fmt"
 	"github.com/aiechoic/services/ioc/healthy"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	"log/slog"
+	"path/filepath"
 	"runtime"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-type withPkgFunc[T any] struct {
-	pkg string
-	f   func() T
+type withPkgFunc[F any] struct {
+	pkg   string
+	owner injector // provider whose factory registered f, nil if none
+	f     F
 }
 
+type closeFunc = func(ctx context.Context) error
+
+// Container is handed to provider factories. Every factory receives a
+// derived Container sharing the same state but carrying the resolution
+// chain that led to it, which is how dependency cycles are detected.
 type Container struct {
+	*container
+	frame *resolveFrame
+}
+
+type container struct {
+	parent         *container
 	instances      map[injector]any
-	closers        []*withPkgFunc[error]
-	healthCheckers []*withPkgFunc[*healthy.Error]
+	locks          map[injector]*sync.Mutex
+	building       map[injector]*resolveFrame
+	waiting        map[*resolveFrame]*resolveFrame
+	deps           map[injector]map[injector]bool
+	meta           map[injector]*providerMeta
+	closers        []*withPkgFunc[closeFunc]
+	starters       []*withPkgFunc[closeFunc]
+	running        context.Context
+	fail           context.CancelCauseFunc // stops Run with a fatal worker error
+	workers        sync.WaitGroup
+	minBackoff     time.Duration
+	maxBackoff     time.Duration
+	healthCheckers []*healthChecker
 	vipers         *Vipers
+	strictConfig   bool
+	configFlags    *pflag.FlagSet
+	overrides      map[injector]func(c *Container) (any, error)
+	guard          func(p fmt.Stringer) error
+	interceptors   []Interceptor
+	metrics        Metrics
+	log            atomic.Pointer[slog.Logger] // the built logger, for logger()
+	state          ContainerState
+	closed         chan struct{} // closed once state is StateClosed
+	closeErr       error
 	cancel         context.CancelFunc
+	healthLoops    sync.WaitGroup // the loops started by RunHealthCheck
 	mu             sync.Mutex
 }
 
 func NewContainer() *Container {
-	return &Container{
-		instances: map[injector]any{},
+	return &Container{container: newContainer(nil)}
+}
+
+func newContainer(parent *container) *container {
+	return &container{
+		parent:     parent,
+		instances:  map[injector]any{},
+		locks:      map[injector]*sync.Mutex{},
+		building:   map[injector]*resolveFrame{},
+		waiting:    map[*resolveFrame]*resolveFrame{},
+		deps:       map[injector]map[injector]bool{},
+		meta:       map[injector]*providerMeta{},
+		overrides:  map[injector]func(c *Container) (any, error){},
+		minBackoff: time.Second,
+		maxBackoff: time.Minute,
+	}
+}
+
+// NewScope returns a child container. The scope resolves instances from its
+// parent, but instances Set on it and instances of providers created with
+// NewScopedProvider are held by the scope itself. Closers registered by the
+// factories of scoped providers run when the scope is closed.
+func (c *Container) NewScope() *Container {
+	return &Container{container: newContainer(c.container)}
+}
+
+func (c *container) root() *container {
+	for c.parent != nil {
+		c = c.parent
+	}
+	return c
+}
+
+// home returns the container holding the instance of p when it is
+// resolved from c.
+func (c *container) home(p injector) *container {
+	if p.isScoped() {
+		return c
 	}
+	return c.root()
 }
 
 func (c *Container) LoadConfig(dir string, env ConfigEnv) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
 	config, err := NewVipers(dir, env)
 	if err != nil {
 		return err
 	}
-	c.vipers = config
+	return c.setConfig(config)
+}
+
+// LoadConfigMap loads the config sections from memory instead of a
+// directory. Sections missing from the map are reported as errors instead
+// of being created from their defaults.
+func (c *Container) LoadConfigMap(sections map[string]map[string]any) error {
+	config, err := NewVipersFromMap(sections)
+	if err != nil {
+		return err
+	}
+	return c.setConfig(config)
+}
+
+// setConfig replaces the config of the root container, closing the previous
+// one.
+func (c *Container) setConfig(config *Vipers) error {
+	r := c.root()
+	r.mu.Lock()
+	flags := r.configFlags
+	r.mu.Unlock()
+	if flags != nil {
+		if err := config.SetFlags(flags); err != nil {
+			_ = config.Close()
+			return err
+		}
+	}
+	r.mu.Lock()
+	prev := r.vipers
+	r.vipers = config
+	config.SetStrict(r.strictConfig)
+	r.mu.Unlock()
+	if prev != nil {
+		_ = prev.Close()
+	}
+	return nil
+}
+
+// ConfigHistory returns the recorded changes of the config sections
+// matching q, oldest first.
+func (c *Container) ConfigHistory(q ConfigHistoryQuery) ([]*ConfigChange, error) {
+	vipers, err := c.config()
+	if err != nil {
+		return nil, err
+	}
+	return vipers.History(q), nil
+}
+
+// AddConfigAuditSink sends each future change of a config section to sink.
+func (c *Container) AddConfigAuditSink(sink AuditSink) error {
+	vipers, err := c.config()
+	if err != nil {
+		return err
+	}
+	vipers.AddAuditSink(sink)
 	return nil
 }
 
+// AddConfigSource adds src as a layer on top of the loaded config, polled
+// every interval. See Vipers.AddSource.
+func (c *Container) AddConfigSource(ctx context.Context, src ConfigSource, interval time.Duration) error {
+	vipers, err := c.config()
+	if err != nil {
+		return err
+	}
+	return vipers.AddSource(ctx, src, interval)
+}
+
+// SetStrictConfig makes loading a missing config section an error instead of
+// writing its default content into the config dir. Use WriteDefaultConfigs,
+// or the iocconfig command, to generate the defaults ahead of time.
+func (c *Container) SetStrictConfig(strict bool) {
+	r := c.root()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.strictConfig = strict
+	if r.vipers != nil {
+		r.vipers.SetStrict(strict)
+	}
+}
+
+// SetConfigFlags overrides the keys of the config sections with the flags
+// of fs set on the command line, named after FlagName. BindConfigFlags adds
+// a flag for every key of the registered config types.
+func (c *Container) SetConfigFlags(fs *pflag.FlagSet) error {
+	r := c.root()
+	r.mu.Lock()
+	r.configFlags = fs
+	vipers := r.vipers
+	r.mu.Unlock()
+	if vipers != nil {
+		return vipers.SetFlags(fs)
+	}
+	return nil
+}
+
+func (c *Container) config() (*Vipers, error) {
+	r := c.root()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.vipers == nil {
+		return nil, fmt.Errorf("config not loaded")
+	}
+	return r.vipers, nil
+}
+
 func (c *Container) UnmarshalConfig(name string, v any, defaultContent []byte) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.vipers == nil {
-		return fmt.Errorf("config not loaded")
+	c.recordConfig(name)
+	vipers, err := c.config()
+	if err != nil {
+		return err
+	}
+	return vipers.Unmarshal(name, v, defaultContent)
+}
+
+// RedactedConfig returns the settings of config section name with resolved
+// secret references and credential keys masked, safe to log.
+func (c *Container) RedactedConfig(name string) (map[string]any, error) {
+	vipers, err := c.config()
+	if err != nil {
+		return nil, err
 	}
-	return c.vipers.Unmarshal(name, v, defaultContent)
+	return vipers.Redacted(name)
 }
 
 func (c *Container) WatchConfig(name string, handler func(v *viper.Viper)) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.vipers == nil {
-		return fmt.Errorf("config not loaded")
+	c.recordConfig(name)
+	vipers, err := c.config()
+	if err != nil {
+		return err
 	}
-	return c.vipers.WatchConfig(name, handler)
+	return vipers.WatchConfig(name, handler)
 }
 
 func (c *Container) UnmarshalAndWatchConfig(name string, defaultContent []byte, handler func(v *viper.Viper)) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.vipers == nil {
-		return fmt.Errorf("config not loaded")
+	c.recordConfig(name)
+	vipers, err := c.config()
+	if err != nil {
+		return err
 	}
-	return c.vipers.UnmarshalAndWatch(name, defaultContent, handler)
+	return vipers.UnmarshalAndWatch(name, defaultContent, handler)
 }
 
-func (c *Container) get(p injector) (any, bool) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	i, ok := c.instances[p]
-	return i, ok
+// get looks up the instance of p in c and, unless p is scoped, in the
+// ancestors of c.
+func (c *container) get(p injector) (any, bool) {
+	if p.isScoped() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		i, ok := c.instances[p]
+		return i, ok
+	}
+	for ; c != nil; c = c.parent {
+		c.mu.Lock()
+		i, ok := c.instances[p]
+		c.mu.Unlock()
+		if ok {
+			return i, true
+		}
+	}
+	return nil, false
 }
 
-func (c *Container) set(p injector, ins any) {
+func (c *container) set(p injector, ins any) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.instances[p] = ins
 }
 
+// SetResolveGuard installs a hook consulted before the factory of a provider
+// runs; overridden providers bypass it. An error returned by the guard
+// aborts the resolution.
+func (c *Container) SetResolveGuard(guard func(p fmt.Stringer) error) {
+	r := c.root()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.guard = guard
+}
+
+// Interceptor is called with every instance the container constructs, after
+// the decorators of its provider p, and returns the instance to use, which
+// must have the same type.
+type Interceptor func(c *Container, p fmt.Stringer, ins any) (any, error)
+
+// Intercept adds interceptor to the root container of c: it applies to the
+// instances constructed by the root and every scope, including the parent
+// and sibling scopes when c is a scope. Interceptors run in the order they
+// were added, on Get, GetNew and Refresh alike.
+func (c *Container) Intercept(interceptor Interceptor) {
+	r := c.root()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.interceptors = append(slices.Clip(r.interceptors), interceptor)
+}
+
+// InterceptType adds an interceptor to the root container of c for the
+// instances of type T, whichever provider constructs them.
+func InterceptType[T any](c *Container, interceptor func(c *Container, ins T) (T, error)) {
+	c.Intercept(func(c *Container, p fmt.Stringer, ins any) (any, error) {
+		if t, ok := ins.(T); ok {
+			return interceptor(c, t)
+		}
+		return ins, nil
+	})
+}
+
+// OnClose registers closer to run when c is closed. Once c is closing or
+// closed, closer runs immediately instead.
 func (c *Container) OnClose(closer func() error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.closers = append(c.closers, &withPkgFunc[error]{
-		pkg: getCallerLocation(2),
-		f:   closer,
+	c.onClose(getCallerLocation(2), func(context.Context) error {
+		return closer()
 	})
 }
 
+// OnStop is like OnClose, but the hook receives the shutdown context and is
+// expected to return once it is done.
+func (c *Container) OnStop(stop func(ctx context.Context) error) {
+	c.onClose(getCallerLocation(2), stop)
+}
+
+func (c *Container) onClose(location string, f closeFunc) {
+	c.mu.Lock()
+	if c.state == StateRunning {
+		c.closers = append(c.closers, &withPkgFunc[closeFunc]{
+			pkg:   location,
+			owner: c.owner(),
+			f:     f,
+		})
+		c.mu.Unlock()
+		return
+	}
+	c.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCloseTimeout)
+	defer cancel()
+	if err := f(ctx); err != nil {
+		c.logger().Error("closer registered after close failed", "closer", location, "error", err)
+	}
+}
+
+// owner returns the provider whose factory c was handed to.
+func (c *Container) owner() injector {
+	if c.frame == nil {
+		return nil
+	}
+	return c.frame.p
+}
+
 func getCallerLocation(skip int) string {
 	_, file, line, ok := runtime.Caller(skip)
 	var location string
@@ -101,22 +369,48 @@ func getCallerLocation(skip int) string {
 	return location
 }
 
+// shortLocation trims the path of a location returned by getCallerLocation
+// to the directory and file name.
+func shortLocation(location string) string {
+	dir, file := filepath.Split(location)
+	return filepath.Join(filepath.Base(dir), file)
+}
+
+// OnHealthCheck registers checker under a default component name: the
+// provider whose factory registers it, or the caller location otherwise.
 func (c *Container) OnHealthCheck(checker func() *healthy.Error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.healthCheckers = append(c.healthCheckers, &withPkgFunc[*healthy.Error]{
-		pkg: getCallerLocation(2),
-		f:   checker,
-	})
+	location := getCallerLocation(2)
+	name := location
+	if owner := c.owner(); owner != nil {
+		name = owner.String()
+	}
+	c.onHealthCheck(name, location, checker)
 }
 
+// OnNamedHealthCheck registers checker under the given component name.
+func (c *Container) OnNamedHealthCheck(component string, checker func() *healthy.Error) {
+	c.onHealthCheck(component, getCallerLocation(2), checker)
+}
+
+// RunHealthCheck runs the health checks every ticker, each round bounded by
+// timeout, and passes the errors to handler until c is closed. A round
+// interrupted by Close is not passed to handler.
 func (c *Container) RunHealthCheck(ticker, timeout time.Duration, handler func(errs []*healthy.Error)) {
 	t := time.NewTicker(ticker)
 	ctx, cancel := context.WithCancel(context.Background())
 	c.mu.Lock()
-	c.cancel = cancel
+	if prev := c.cancel; prev != nil {
+		c.cancel = func() {
+			prev()
+			cancel()
+		}
+	} else {
+		c.cancel = cancel
+	}
+	c.healthLoops.Add(1)
 	c.mu.Unlock()
 	go func() {
+		defer c.healthLoops.Done()
 		defer t.Stop()
 		for {
 			select {
@@ -133,6 +427,9 @@ func (c *Container) RunHealthCheck(ticker, timeout time.Duration, handler func(e
 						defer subCancel()
 					}
 					errs := c.CheckHealth(subCtx)
+					if ctx.Err() != nil {
+						return
+					}
 					handler(errs)
 				}()
 			}
@@ -140,49 +437,16 @@ func (c *Container) RunHealthCheck(ticker, timeout time.Duration, handler func(e
 	}()
 }
 
+// CheckHealth runs every health check and returns the errors of the failing
+// ones, see CheckHealthReports.
 func (c *Container) CheckHealth(ctx context.Context) []*healthy.Error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	// Check if context is done
-	select {
-	case <-ctx.Done():
-		return nil
-	default:
-	}
-
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-	var errors []*healthy.Error
-
-	for _, checker := range c.healthCheckers {
-		wg.Add(1)
-		go func(checker *withPkgFunc[*healthy.Error]) {
-			defer wg.Done()
-			errChan := make(chan *healthy.Error, 1)
-			go func() {
-				errChan <- checker.f()
-			}()
-
-			var err *healthy.Error
-			select {
-			case err = <-errChan:
-			case <-ctx.Done():
-				err = &healthy.Error{
-					Level: healthy.LError,
-					Msg:   fmt.Sprintf("%s: %s", checker.pkg, ctx.Err()),
-				}
-			}
-			if err != nil {
-				mu.Lock()
-				errors = append(errors, err)
-				mu.Unlock()
-			}
-		}(checker)
+	var errs []*healthy.Error
+	for _, r := range c.CheckHealthReports(ctx) {
+		if err := r.Err(); err != nil {
+			errs = append(errs, err)
+		}
 	}
-
-	wg.Wait()
-	return errors
+	return errs
 }
 
 type MultiError []error
@@ -195,30 +459,146 @@ func (m MultiError) Error() string {
 	return s
 }
 
+// Unwrap lets errors.Is and errors.As match any of the errors.
+func (m MultiError) Unwrap() []error {
+	return m
+}
+
+const defaultCloseTimeout = 5 * time.Second
+
 func (c *Container) Close() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCloseTimeout)
 	defer cancel()
 	return c.CloseWithContext(ctx)
 }
 
+// CloseWithContext runs the registered closers in reverse dependency order:
+// closers registered outside any factory first, then those of each provider
+// before those of the providers it resolved. Closers of the same level run
+// in parallel; the returned MultiError holds one MultiError per failed level.
+//
+// Once closing starts, resolving providers from c or its scopes fails with
+// ErrContainerClosed. Closing again waits for the first close, bounded by
+// ctx, and returns its result without running the closers again.
 func (c *Container) CloseWithContext(ctx context.Context) error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	if c.state != StateRunning {
+		closed := c.closed
+		c.mu.Unlock()
+		select {
+		case <-closed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.closeErr
+	}
+	c.state = StateClosing
+	c.closed = make(chan struct{})
+	vipers := c.vipers
+	c.mu.Unlock()
+
+	var errs []error
+	// stop config reloads first; subscribers may need c.mu
+	if vipers != nil {
+		if err := vipers.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close config watcher: %w", err))
+		}
+	}
+
+	c.mu.Lock()
 	if c.cancel != nil {
 		c.cancel()
 	}
+	levels := c.closeLevels()
+	c.closers = nil
+	c.mu.Unlock()
+	// let a health check round in progress end before closing what it checks
+	c.healthLoops.Wait()
 
+	for i, level := range levels {
+		if err := closeLevel(ctx, level); err != nil {
+			errs = append(errs, fmt.Errorf("close level %d: %w", i, err))
+		}
+	}
+
+	var err error
+	if len(errs) > 0 {
+		err = MultiError(errs)
+	}
+	c.mu.Lock()
+	c.state = StateClosed
+	c.closeErr = err
+	close(c.closed)
+	c.mu.Unlock()
+	return err
+}
+
+// closeLevels groups the closers by the length of the longest chain of
+// dependents of their owner. c.mu must be held.
+func (c *Container) closeLevels() [][]*withPkgFunc[closeFunc] {
+	dependents := map[injector][]injector{}
+	for p, deps := range c.deps {
+		for d := range deps {
+			dependents[d] = append(dependents[d], p)
+		}
+	}
+	depth := map[injector]int{}
+	var visit func(p injector, seen map[injector]bool) int
+	visit = func(p injector, seen map[injector]bool) int {
+		if d, ok := depth[p]; ok {
+			return d
+		}
+		seen[p] = true
+		d := 0
+		for _, dep := range dependents[p] {
+			if !seen[dep] {
+				d = max(d, visit(dep, seen)+1)
+			}
+		}
+		delete(seen, p)
+		depth[p] = d
+		return d
+	}
+
+	var levels [][]*withPkgFunc[closeFunc]
+	for _, clo := range c.closers {
+		level := 0
+		if clo.owner != nil {
+			level = visit(clo.owner, map[injector]bool{}) + 1
+		}
+		for len(levels) <= level {
+			levels = append(levels, nil)
+		}
+		levels[level] = append(levels[level], clo)
+	}
+
+	var nonEmpty [][]*withPkgFunc[closeFunc]
+	for _, level := range levels {
+		if len(level) > 0 {
+			nonEmpty = append(nonEmpty, level)
+		}
+	}
+	return nonEmpty
+}
+
+func closeLevel(ctx context.Context, closers []*withPkgFunc[closeFunc]) error {
 	var errs []error
 	var wg sync.WaitGroup
 	var mu sync.Mutex
 
-	for _, clo := range c.closers {
+	for _, clo := range closers {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", clo.pkg, err))
+			continue
+		}
 		wg.Add(1)
-		go func(clo *withPkgFunc[error]) {
+		go func(clo *withPkgFunc[closeFunc]) {
 			defer wg.Done()
 			errChan := make(chan error, 1)
 			go func() {
-				errChan <- clo.f()
+				errChan <- clo.f(ctx)
 			}()
 
 			var err error
@@ -4,7 +4,10 @@ import (
 	"context"
 	"errors"
 	"github.com/aiechoic/services/ioc"
+	"github.com/aiechoic/services/ioc/healthy"
 	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -79,3 +82,362 @@ func TestCloseWithContext(t *testing.T) {
 	assert.False(t, closer3Called, "closer3 should not be called")
 	assert.Contains(t, err.Error(), "context deadline exceeded")
 }
+
+type cycleA struct{ _ int }
+type cycleB struct{ _ int }
+type cycleC struct{ _ int }
+
+func TestDependencyCycle(t *testing.T) {
+	var aProvider *ioc.Provider[*cycleA]
+	var bProvider *ioc.Provider[*cycleB]
+	var cProvider *ioc.Provider[*cycleC]
+	aProvider = ioc.NewProvider(func(c *ioc.Container) (*cycleA, error) {
+		_, err := bProvider.Get(c)
+		return &cycleA{}, err
+	})
+	bProvider = ioc.NewProvider(func(c *ioc.Container) (*cycleB, error) {
+		_, err := cProvider.Get(c)
+		return &cycleB{}, err
+	})
+	cProvider = ioc.NewProvider(func(c *ioc.Container) (*cycleC, error) {
+		_, err := aProvider.Get(c)
+		return &cycleC{}, err
+	})
+
+	c := ioc.NewContainer()
+	_, err := aProvider.Get(c)
+	assert.ErrorIs(t, err, ioc.ErrDependencyCycle)
+	msg := err.Error()
+	assert.Contains(t, msg, "Provider[*ioc_test.cycleA]")
+	assert.Contains(t, msg, "Provider[*ioc_test.cycleB]")
+	assert.Contains(t, msg, "Provider[*ioc_test.cycleC]")
+	assert.Contains(t, msg, "container_test.go:")
+	assert.False(t, aProvider.IsSet(c))
+}
+
+func TestDependencyCycleAcrossGoroutines(t *testing.T) {
+	var aProvider *ioc.Provider[*cycleA]
+	var bProvider *ioc.Provider[*cycleB]
+	var wg sync.WaitGroup
+	wg.Add(2)
+	var aOnce, bOnce sync.Once
+	aProvider = ioc.NewProvider(func(c *ioc.Container) (*cycleA, error) {
+		aOnce.Do(func() {
+			wg.Done()
+			wg.Wait()
+		})
+		_, err := bProvider.Get(c)
+		return &cycleA{}, err
+	})
+	bProvider = ioc.NewProvider(func(c *ioc.Container) (*cycleB, error) {
+		bOnce.Do(func() {
+			wg.Done()
+			wg.Wait()
+		})
+		_, err := aProvider.Get(c)
+		return &cycleB{}, err
+	})
+
+	c := ioc.NewContainer()
+	errs := make(chan error, 2)
+	go func() {
+		_, err := aProvider.Get(c)
+		errs <- err
+	}()
+	go func() {
+		_, err := bProvider.Get(c)
+		errs <- err
+	}()
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errs:
+			assert.ErrorIs(t, err, ioc.ErrDependencyCycle)
+		case <-time.After(5 * time.Second):
+			t.Fatal("deadlock: cycle across goroutines not detected")
+		}
+	}
+}
+
+func TestConcurrentGet(t *testing.T) {
+	var built atomic.Int32
+	slowProvider := ioc.NewProvider(func(c *ioc.Container) (*cycleA, error) {
+		built.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		return &cycleA{}, nil
+	})
+	dependents := make([]*ioc.Provider[*cycleB], 10)
+	for i := range dependents {
+		dependents[i] = ioc.NewProvider(func(c *ioc.Container) (*cycleB, error) {
+			_, err := slowProvider.Get(c)
+			return &cycleB{}, err
+		})
+	}
+
+	c := ioc.NewContainer()
+	var wg sync.WaitGroup
+	for _, p := range dependents {
+		wg.Add(1)
+		go func(p *ioc.Provider[*cycleB]) {
+			defer wg.Done()
+			_, err := p.Get(c)
+			assert.NoError(t, err)
+		}(p)
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), built.Load())
+}
+
+func TestCloseInDependencyOrder(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	closer := func(name string) func() error {
+		return func() error {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, name)
+			return nil
+		}
+	}
+	cProvider := ioc.NewProvider(func(c *ioc.Container) (*cycleC, error) {
+		c.OnClose(closer("c"))
+		return &cycleC{}, nil
+	})
+	bProvider := ioc.NewProvider(func(c *ioc.Container) (*cycleB, error) {
+		cProvider.MustGet(c)
+		c.OnClose(closer("b"))
+		return &cycleB{}, nil
+	})
+	aProvider := ioc.NewProvider(func(c *ioc.Container) (*cycleA, error) {
+		c.OnClose(closer("a"))
+		bProvider.MustGet(c)
+		cProvider.MustGet(c)
+		return &cycleA{}, nil
+	})
+
+	c := ioc.NewContainer()
+	cProvider.MustGet(c)
+	aProvider.MustGet(c)
+	c.OnClose(closer("main"))
+
+	assert.NoError(t, c.Close())
+	assert.Equal(t, []string{"main", "a", "b", "c"}, order)
+}
+
+func TestCloseLevelErrors(t *testing.T) {
+	bProvider := ioc.NewProvider(func(c *ioc.Container) (*cycleB, error) {
+		c.OnClose(func() error {
+			return errors.New("b error")
+		})
+		return &cycleB{}, nil
+	})
+	aProvider := ioc.NewProvider(func(c *ioc.Container) (*cycleA, error) {
+		bProvider.MustGet(c)
+		c.OnClose(func() error {
+			time.Sleep(2 * time.Second)
+			return nil
+		})
+		return &cycleA{}, nil
+	})
+
+	c := ioc.NewContainer()
+	aProvider.MustGet(c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	err := c.CloseWithContext(ctx)
+
+	var multi ioc.MultiError
+	assert.ErrorAs(t, err, &multi)
+	assert.Len(t, multi, 2)
+	assert.Contains(t, multi[0].Error(), "context deadline exceeded")
+	assert.Contains(t, multi[1].Error(), "context deadline exceeded")
+	assert.NotContains(t, err.Error(), "b error")
+}
+
+func TestRun(t *testing.T) {
+	c := ioc.NewContainer()
+	c.SetRestartBackoff(10*time.Millisecond, 50*time.Millisecond)
+
+	var attempts atomic.Int32
+	c.OnStart(func(ctx context.Context) error {
+		if attempts.Add(1) < 3 {
+			return errors.New("crashed")
+		}
+		<-ctx.Done()
+		return nil
+	})
+	var panics atomic.Int32
+	c.OnStart(func(ctx context.Context) error {
+		if panics.Add(1) == 1 {
+			panic("boom")
+		}
+		<-ctx.Done()
+		return nil
+	})
+	var stopped atomic.Bool
+	c.OnStop(func(ctx context.Context) error {
+		stopped.Store(true)
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+		cancel()
+	}()
+	assert.NoError(t, c.Run(ctx))
+	assert.Equal(t, int32(3), attempts.Load())
+	assert.Equal(t, int32(2), panics.Load())
+	assert.True(t, stopped.Load())
+}
+
+func TestRun_Fatal(t *testing.T) {
+	c := ioc.NewContainer()
+	c.SetRestartBackoff(10*time.Millisecond, 50*time.Millisecond)
+
+	var attempts atomic.Int32
+	c.OnStart(func(ctx context.Context) error {
+		attempts.Add(1)
+		return ioc.Fatal(errors.New("address already in use"))
+	})
+	var stopped atomic.Bool
+	c.OnStart(func(ctx context.Context) error {
+		<-ctx.Done()
+		stopped.Store(true)
+		return nil
+	})
+
+	err := c.Run(context.Background())
+	assert.ErrorIs(t, err, ioc.ErrFatal)
+	assert.ErrorContains(t, err, "address already in use")
+	assert.Equal(t, int32(1), attempts.Load())
+	assert.True(t, stopped.Load())
+	assert.Equal(t, ioc.StateClosed, c.State())
+}
+
+func TestScope(t *testing.T) {
+	var closed []string
+	singleton := ioc.NewProvider(func(c *ioc.Container) (*cycleA, error) {
+		c.OnClose(func() error {
+			closed = append(closed, "singleton")
+			return nil
+		})
+		return &cycleA{}, nil
+	})
+	scoped := ioc.NewScopedProvider(func(c *ioc.Container) (*cycleB, error) {
+		singleton.MustGet(c)
+		c.OnClose(func() error {
+			closed = append(closed, "scoped")
+			return nil
+		})
+		return &cycleB{}, nil
+	})
+	override := ioc.NewProvider(func(c *ioc.Container) (*cycleC, error) {
+		return &cycleC{}, nil
+	})
+
+	c := ioc.NewContainer()
+	rootC := override.MustGet(c)
+
+	scope1 := c.NewScope()
+	scope2 := c.NewScope()
+	b1 := scoped.MustGet(scope1)
+	b2 := scoped.MustGet(scope2)
+	assert.True(t, b1 != b2)
+	assert.True(t, b1 == scoped.MustGet(scope1))
+	assert.True(t, singleton.MustGet(scope1) == singleton.MustGet(c))
+	assert.False(t, scoped.IsSet(c))
+
+	scopeC := &cycleC{}
+	override.Set(scope1, scopeC)
+	assert.True(t, override.MustGet(scope1) == scopeC)
+	assert.True(t, override.MustGet(scope2) == rootC)
+
+	assert.NoError(t, scope1.Close())
+	assert.Equal(t, []string{"scoped"}, closed)
+	assert.NoError(t, c.Close())
+	assert.Equal(t, []string{"scoped", "singleton"}, closed)
+}
+
+func TestScope_CaptiveDependency(t *testing.T) {
+	scoped := ioc.NewScopedProvider(func(c *ioc.Container) (*cycleB, error) {
+		return &cycleB{}, nil
+	})
+	singleton := ioc.NewProvider(func(c *ioc.Container) (*cycleA, error) {
+		_, err := scoped.Get(c)
+		return &cycleA{}, err
+	})
+
+	c := ioc.NewContainer()
+	_, err := singleton.Get(c.NewScope())
+	assert.ErrorIs(t, err, ioc.ErrCaptiveDependency)
+	assert.False(t, scoped.IsSet(c))
+}
+
+func TestHealthReports(t *testing.T) {
+	engine := ioc.NewProvider(func(c *ioc.Container) (*cycleA, error) {
+		c.OnHealthCheck(func() *healthy.Error {
+			return nil
+		})
+		return &cycleA{}, nil
+	})
+
+	c := ioc.NewContainer()
+	engine.MustGet(c)
+	var failing atomic.Bool
+	c.OnNamedHealthCheck("queue", func() *healthy.Error {
+		if failing.Load() {
+			return &healthy.Error{Level: healthy.LWarn, Msg: "queue length: 12"}
+		}
+		return nil
+	})
+
+	ctx := context.Background()
+	reports := c.CheckHealthReports(ctx)
+	assert.Len(t, reports, 2)
+	assert.Equal(t, engine.String(), reports[0].Component)
+	assert.Equal(t, healthy.StatusOK, reports[1].Status)
+	lastSuccess := reports[1].LastSuccess
+
+	failing.Store(true)
+	c.CheckHealth(ctx)
+	errs := c.CheckHealth(ctx)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "queue", errs[0].Component)
+
+	history := c.HealthHistory()["queue"]
+	assert.Len(t, history, 3)
+	last := history[2]
+	assert.Equal(t, healthy.StatusFailing, last.Status)
+	assert.Equal(t, healthy.LWarn, last.Level)
+	assert.Equal(t, 2, last.ConsecutiveFailures)
+	assert.Equal(t, lastSuccess, last.LastSuccess)
+}
+
+func TestRunHealthCheck_Close(t *testing.T) {
+	c := ioc.NewContainer()
+	running := make(chan struct{}, 1)
+	release := make(chan struct{})
+	defer close(release)
+	c.OnNamedHealthCheck("slow", func() *healthy.Error {
+		select {
+		case running <- struct{}{}:
+		default:
+		}
+		<-release
+		return nil
+	})
+
+	// a round interrupted by Close is not reported
+	var handled atomic.Int32
+	c.RunHealthCheck(10*time.Millisecond, time.Minute, func([]*healthy.Error) {
+		handled.Add(1)
+	})
+	select {
+	case <-running:
+	case <-time.After(5 * time.Second):
+		t.Fatal("health check not run")
+	}
+	assert.NoError(t, c.Close())
+	assert.Zero(t, handled.Load())
+}
@@ -0,0 +1,76 @@
+package ioc
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type decorated struct {
+	layers []string
+}
+
+func (d *decorated) wrap(layer string) *decorated {
+	return &decorated{layers: append(append([]string(nil), d.layers...), layer)}
+}
+
+func TestProvider_Decorate(t *testing.T) {
+	p := NewProvider(func(c *Container) (*decorated, error) {
+		return &decorated{layers: []string{"factory"}}, nil
+	})
+	p.Decorate(func(c *Container, ins *decorated) (*decorated, error) {
+		return ins.wrap("tracing"), nil
+	}).Decorate(func(c *Container, ins *decorated) (*decorated, error) {
+		return ins.wrap("metrics"), nil
+	})
+
+	c := NewContainer()
+	defer c.Close()
+	var intercepted []string
+	c.Intercept(func(c *Container, p fmt.Stringer, ins any) (any, error) {
+		intercepted = append(intercepted, p.String())
+		return ins, nil
+	})
+	InterceptType(c, func(c *Container, ins *decorated) (*decorated, error) {
+		return ins.wrap("cache"), nil
+	})
+	InterceptType(c, func(c *Container, ins string) (string, error) {
+		return "", errors.New("never called")
+	})
+
+	want := []string{"factory", "tracing", "metrics", "cache"}
+	assert.Equal(t, want, p.MustGet(c).layers)
+	assert.Equal(t, want, p.MustGetNew(c).layers)
+	assert.Equal(t, want, p.MustRefresh(c).layers)
+	assert.Equal(t, []string{p.String(), p.String(), p.String()}, intercepted)
+
+	// overrides are decorated too
+	p.Override(c, func(c *Container) (*decorated, error) {
+		return &decorated{layers: []string{"fake"}}, nil
+	})
+	assert.Equal(t, []string{"fake", "tracing", "metrics", "cache"}, p.MustGetNew(c).layers)
+}
+
+func TestProvider_DecorateErrors(t *testing.T) {
+	p := NewProvider(func(c *Container) (*decorated, error) {
+		return &decorated{}, nil
+	}).Decorate(func(c *Container, ins *decorated) (*decorated, error) {
+		return nil, errors.New("tracer unavailable")
+	})
+	c := NewContainer()
+	defer c.Close()
+	_, err := p.Get(c)
+	assert.EqualError(t, err, "tracer unavailable")
+	assert.False(t, p.IsSet(c))
+
+	q := NewProvider(func(c *Container) (*decorated, error) {
+		return &decorated{}, nil
+	})
+	c.Intercept(func(c *Container, p fmt.Stringer, ins any) (any, error) {
+		return "wrong type", nil
+	})
+	_, err = q.Get(c)
+	assert.ErrorContains(t, err, "interceptor returned string for provider Provider[*ioc.decorated]")
+}
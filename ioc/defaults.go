@@ -0,0 +1,153 @@
+package ioc
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/spf13/viper"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"sync"
+)
+
+var defaultConfigs = struct {
+	m     map[string][]byte
+	types map[string]reflect.Type
+	mu    sync.Mutex
+}{m: map[string][]byte{}, types: map[string]reflect.Type{}}
+
+// DefaultConfig is the default content of a config section, as registered
+// with RegisterDefaultConfig, and the type registered with
+// RegisterConfigType, if any.
+type DefaultConfig struct {
+	Section string
+	Content []byte
+	Type    reflect.Type
+}
+
+// FileName returns the name of the file holding the section for env, or of
+// the base file when env is empty.
+func (d DefaultConfig) FileName(env ConfigEnv) string {
+	if env == "" {
+		return fmt.Sprintf("%s.%s", d.Section, contentType(d.Content))
+	}
+	return fmt.Sprintf("%s.%s.%s", d.Section, env, contentType(d.Content))
+}
+
+// RegisterDefaultConfig records the default content of a config section so
+// that it can be generated ahead of time instead of being written by the
+// first provider loading it. Packages call it from init.
+func RegisterDefaultConfig(section string, content []byte) {
+	if contentType(content) == "" {
+		panic(fmt.Sprintf("ioc: cannot determine the format of the default config \"%s\"", section))
+	}
+	defaultConfigs.mu.Lock()
+	defer defaultConfigs.mu.Unlock()
+	defaultConfigs.m[section] = content
+}
+
+// DefaultConfigs returns the registered default configs sorted by section.
+func DefaultConfigs() []DefaultConfig {
+	defaultConfigs.mu.Lock()
+	defer defaultConfigs.mu.Unlock()
+	configs := make([]DefaultConfig, 0, len(defaultConfigs.m))
+	for section, content := range defaultConfigs.m {
+		configs = append(configs, DefaultConfig{
+			Section: section,
+			Content: content,
+			Type:    defaultConfigs.types[section],
+		})
+	}
+	sort.Slice(configs, func(i, j int) bool {
+		return configs[i].Section < configs[j].Section
+	})
+	return configs
+}
+
+// WriteDefaultConfigs writes the registered default configs into dir for
+// env, or as base files when env is empty, and returns the written files.
+// Sections that already have a file for the environment chain are skipped
+// unless overwrite is set.
+func WriteDefaultConfigs(dir string, env ConfigEnv, overwrite bool) ([]string, error) {
+	layers, err := scanConfigDir(dir, env.Chain(), unsupportedConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	var written []string
+	for _, d := range DefaultConfigs() {
+		if len(layers[d.Section]) > 0 && !overwrite {
+			continue
+		}
+		filename := filepath.Join(dir, d.FileName(env))
+		err = os.WriteFile(filename, d.Content, 0644)
+		if err != nil {
+			return written, fmt.Errorf("error writing default config file \"%s\": %w", filename, err)
+		}
+		written = append(written, filename)
+	}
+	return written, nil
+}
+
+// ConfigDiff compares a config section in a directory with its default.
+type ConfigDiff struct {
+	Section     string
+	Files       []string // layer files of the section, base first
+	MissingKeys []string // keys of the default that no layer sets
+	UnknownKeys []string // keys set by the layers that the default lacks
+}
+
+// Missing reports whether the section has no file at all.
+func (d *ConfigDiff) Missing() bool {
+	return len(d.Files) == 0
+}
+
+// DiffDefaultConfigs compares the sections found in dir for env with the
+// registered default configs, in section order. Only the layer files are
+// read: references to secrets are not resolved, so the diff does not need
+// them.
+func DiffDefaultConfigs(dir string, env ConfigEnv) ([]*ConfigDiff, error) {
+	layers, err := scanConfigDir(dir, env.Chain(), unsupportedConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	var diffs []*ConfigDiff
+	for _, d := range DefaultConfigs() {
+		def := viper.New()
+		def.SetConfigType(contentType(d.Content))
+		err = def.ReadConfig(bytes.NewReader(d.Content))
+		if err != nil {
+			return nil, fmt.Errorf("error reading default config \"%s\": %w", d.Section, err)
+		}
+		diff := &ConfigDiff{Section: d.Section, Files: layers[d.Section]}
+		if !diff.Missing() {
+			merged := viper.New()
+			for _, file := range diff.Files {
+				v, _, err := readLayerFile(file)
+				if err != nil {
+					return nil, err
+				}
+				err = merged.MergeConfigMap(v.AllSettings())
+				if err != nil {
+					return nil, fmt.Errorf("error merging config \"%s\": %w", d.Section, err)
+				}
+			}
+			defKeys, keys := def.AllKeys(), merged.AllKeys()
+			for _, k := range defKeys {
+				if !slices.Contains(keys, k) {
+					diff.MissingKeys = append(diff.MissingKeys, k)
+				}
+			}
+			for _, k := range keys {
+				if !slices.Contains(defKeys, k) {
+					diff.UnknownKeys = append(diff.UnknownKeys, k)
+				}
+			}
+			sort.Strings(diff.MissingKeys)
+			sort.Strings(diff.UnknownKeys)
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs, nil
+}
@@ -0,0 +1,70 @@
+package ioc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultConfigs(t *testing.T) {
+	RegisterDefaultConfig("defaults-test", []byte("host: localhost\nport: 80\n"))
+	dir := t.TempDir()
+
+	diffs, err := DiffDefaultConfigs(dir, ConfigEnvTest)
+	assert.NoError(t, err)
+	diff := findDiff(diffs, "defaults-test")
+	if assert.NotNil(t, diff) {
+		assert.True(t, diff.Missing())
+	}
+
+	files, err := WriteDefaultConfigs(dir, ConfigEnvTest, false)
+	assert.NoError(t, err)
+	assert.Contains(t, files, filepath.Join(dir, "defaults-test.test.yaml"))
+
+	// existing sections are kept
+	file := filepath.Join(dir, "defaults-test.test.yaml")
+	// references are not resolved, the secrets need not exist
+	data := "host: ${DEFAULTS_TEST_MISSING_HOST}\nextra: file:///missing/secret\n"
+	assert.NoError(t, os.WriteFile(file, []byte(data), 0644))
+	files, err = WriteDefaultConfigs(dir, ConfigEnvTest, false)
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+
+	diffs, err = DiffDefaultConfigs(dir, ConfigEnvTest)
+	assert.NoError(t, err)
+	diff = findDiff(diffs, "defaults-test")
+	if assert.NotNil(t, diff) {
+		assert.Equal(t, []string{file}, diff.Files)
+		assert.Equal(t, []string{"port"}, diff.MissingKeys)
+		assert.Equal(t, []string{"extra"}, diff.UnknownKeys)
+	}
+}
+
+func findDiff(diffs []*ConfigDiff, section string) *ConfigDiff {
+	for _, d := range diffs {
+		if d.Section == section {
+			return d
+		}
+	}
+	return nil
+}
+
+func TestContainer_SetStrictConfig(t *testing.T) {
+	dir := t.TempDir()
+	c := NewContainer()
+	defer c.Close()
+	c.SetStrictConfig(true)
+	assert.NoError(t, c.LoadConfig(dir, ConfigEnvTest))
+
+	var cfg map[string]any
+	err := c.UnmarshalConfig("strict-test", &cfg, []byte("key: value\n"))
+	assert.ErrorContains(t, err, "strict mode")
+	_, err = os.Stat(filepath.Join(dir, "strict-test.test.yaml"))
+	assert.True(t, os.IsNotExist(err))
+
+	c.SetStrictConfig(false)
+	assert.NoError(t, c.UnmarshalConfig("strict-test", &cfg, []byte("key: value\n")))
+	assert.Equal(t, "value", cfg["key"])
+}
@@ -0,0 +1,43 @@
+package validate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aiechoic/services/ioc"
+)
+
+type Config struct{ Name string }
+
+var configProvider = ioc.NewProvider(func(c *ioc.Container) (*Config, error) {
+	return &Config{Name: "config"}, nil
+})
+
+type Generator struct{ Config *Config }
+
+var generatorProvider = ioc.NewProvider(func(c *ioc.Container) (*Generator, error) {
+	return &Generator{Config: configProvider.MustGet(c)}, nil
+})
+
+type Mailer struct{}
+
+var mailerProvider = ioc.NewProvider(func(c *ioc.Container) (*Mailer, error) {
+	return nil, errors.New("invalid smtp host")
+})
+
+func Example() {
+	c := ioc.NewContainer()
+	defer c.Close()
+
+	// construct every registered provider before serving requests,
+	// instead of failing on the first request that needs it
+	err := c.ValidateParallel(context.Background(), 4)
+	fmt.Println(err)
+
+	fmt.Println(generatorProvider.IsSet(c))
+
+	// Output:
+	// Provider[*validate.Mailer](validate/example_test.go:24): invalid smtp host
+	//
+	// true
+}
@@ -0,0 +1,221 @@
+package ioc
+
+import (
+	"fmt"
+	"github.com/spf13/pflag"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+var envNameReplacer = strings.NewReplacer("-", "_", ".", "_")
+
+// EnvVarName returns the environment variable overriding key of config
+// section: both joined by an underscore, upper-cased, with dashes and dots
+// replaced by underscores. The http_port key of the gin-service section is
+// overridden by GIN_SERVICE_HTTP_PORT, health.enable by
+// GIN_SERVICE_HEALTH_ENABLE.
+func EnvVarName(section, key string) string {
+	return envPrefix(section) + "_" + strings.ToUpper(envNameReplacer.Replace(key))
+}
+
+func envPrefix(section string) string {
+	return strings.ToUpper(envNameReplacer.Replace(section))
+}
+
+// FlagName returns the command-line flag overriding key of config section,
+// such as "gin-service.http_port".
+func FlagName(section, key string) string {
+	return section + "." + key
+}
+
+// ConfigKey is a leaf key of a registered config type.
+type ConfigKey struct {
+	Section string
+	Key     string // dotted path, e.g. "health.enable"
+	Type    reflect.Type
+}
+
+func (k ConfigKey) EnvVar() string {
+	return EnvVarName(k.Section, k.Key)
+}
+
+func (k ConfigKey) Flag() string {
+	return FlagName(k.Section, k.Key)
+}
+
+// ConfigKeys returns the leaf keys of the config types registered with
+// RegisterConfigType, sorted by section and key. Keys below maps and lists
+// are not included.
+func ConfigKeys() []ConfigKey {
+	defaultConfigs.mu.Lock()
+	types := make(map[string]reflect.Type, len(defaultConfigs.types))
+	for section, t := range defaultConfigs.types {
+		types[section] = t
+	}
+	defaultConfigs.mu.Unlock()
+
+	var keys []ConfigKey
+	for section, t := range types {
+		keys = append(keys, configKeys(section, t, "")...)
+	}
+	slices.SortFunc(keys, func(a, b ConfigKey) int {
+		if c := strings.Compare(a.Section, b.Section); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Key, b.Key)
+	})
+	return keys
+}
+
+func configKeys(section string, t reflect.Type, prefix string) []ConfigKey {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t.Kind() == reflect.Map:
+		return nil
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Struct:
+		return nil
+	case t.Kind() != reflect.Struct || t == reflect.TypeFor[time.Time]():
+		return []ConfigKey{{Section: section, Key: prefix, Type: t}}
+	}
+	fields, _ := configFields(t)
+	var keys []ConfigKey
+	for _, f := range fields {
+		keys = append(keys, configKeys(section, f.typ, joinKey(prefix, f.name))...)
+	}
+	return keys
+}
+
+// BindConfigFlags adds to fs a flag named FlagName(section, key) for every
+// key of ConfigKeys with a scalar or string list type. Pass fs to
+// Container.SetConfigFlags once parsed:
+//
+//	ioc.BindConfigFlags(pflag.CommandLine)
+//	pflag.Parse()
+//	c.SetConfigFlags(pflag.CommandLine)
+func BindConfigFlags(fs *pflag.FlagSet) {
+	for _, k := range ConfigKeys() {
+		name := k.Flag()
+		if fs.Lookup(name) != nil {
+			continue
+		}
+		usage := fmt.Sprintf("override %s of config %s (env %s)", k.Key, k.Section, k.EnvVar())
+		if k.Type == reflect.TypeFor[time.Duration]() {
+			fs.Duration(name, 0, usage)
+			continue
+		}
+		switch k.Type.Kind() {
+		case reflect.String:
+			fs.String(name, "", usage)
+		case reflect.Bool:
+			fs.Bool(name, false, usage)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			fs.Int64(name, 0, usage)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			fs.Uint64(name, 0, usage)
+		case reflect.Float32, reflect.Float64:
+			fs.Float64(name, 0, usage)
+		case reflect.Slice:
+			if k.Type.Elem().Kind() == reflect.String {
+				fs.StringSlice(name, nil, usage)
+			}
+		}
+	}
+}
+
+// SetFlags sets the command-line flags overriding the keys of the sections,
+// and reloads the sections already loaded. Only the flags set on the
+// command line apply.
+func (c *Vipers) SetFlags(fs *pflag.FlagSet) error {
+	c.reloads.Lock()
+	defer c.reloads.Unlock()
+	c.mu.Lock()
+	c.flags = fs
+	files := map[string][]string{}
+	for name := range c.encoders {
+		files[name] = c.files[name]
+	}
+	c.mu.Unlock()
+
+	var errs []error
+	for _, name := range sortedKeys(files) {
+		if err := c.reload(name, files[name]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return MultiError(errs)
+	}
+	return nil
+}
+
+// overrideSettings sets in settings the keys of section name overridden by
+// environment variables, then by the command-line flags, and writes them to
+// sum. It returns the keys set by flags, which take precedence over the
+// environment variables read by the section viper. c.mu must be held.
+func (c *Vipers) overrideSettings(name string, settings map[string]any, origins map[string]string, sum io.Writer) map[string]any {
+	leaves := map[string]any{}
+	flattenSettings(settings, "", leaves)
+	defaultConfigs.mu.Lock()
+	t := defaultConfigs.types[name]
+	defaultConfigs.mu.Unlock()
+	if t != nil {
+		for _, k := range configKeys(name, t, "") {
+			leaves[k.Key] = nil
+		}
+	}
+	keys := make([]string, 0, len(leaves))
+	for k := range leaves {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		env := EnvVarName(name, key)
+		if v, ok := os.LookupEnv(env); ok {
+			setSetting(settings, key, v)
+			origins[key] = "env " + env
+			_, _ = fmt.Fprintf(sum, "%s=%s\n", env, v)
+		}
+	}
+
+	flagged := map[string]any{}
+	if c.flags == nil {
+		return flagged
+	}
+	prefix := name + "."
+	c.flags.Visit(func(f *pflag.Flag) {
+		key, ok := strings.CutPrefix(f.Name, prefix)
+		if !ok {
+			return
+		}
+		var v any = f.Value.String()
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			v = sv.GetSlice()
+		}
+		setSetting(settings, key, v)
+		flagged[key] = v
+		origins[key] = "flag --" + f.Name
+		_, _ = fmt.Fprintf(sum, "--%s=%s\n", f.Name, f.Value)
+	})
+	return flagged
+}
+
+// setSetting sets the dotted key of settings to v, creating the parent
+// maps it needs.
+func setSetting(settings map[string]any, key string, v any) {
+	parts := strings.Split(key, ".")
+	for _, p := range parts[:len(parts)-1] {
+		m, ok := settings[p].(map[string]any)
+		if !ok {
+			m = map[string]any{}
+			settings[p] = m
+		}
+		settings = m
+	}
+	settings[parts[len(parts)-1]] = v
+}
@@ -0,0 +1,98 @@
+package ioc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+type flagsHealthConfig struct {
+	Enable  bool          `mapstructure:"enable"`
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+type flagsConfig struct {
+	HttpPort int               `mapstructure:"http_port"`
+	Hosts    []string          `mapstructure:"hosts"`
+	Health   flagsHealthConfig `mapstructure:"health"`
+	Labels   map[string]string `mapstructure:"labels"`
+}
+
+func init() {
+	RegisterConfigType("flags-test", flagsConfig{})
+}
+
+func TestEnvVarName(t *testing.T) {
+	assert.Equal(t, "GIN_SERVICE_HTTP_PORT", EnvVarName("gin-service", "http_port"))
+	assert.Equal(t, "GIN_SERVICE_HEALTH_ENABLE", EnvVarName("gin-service", "health.enable"))
+	assert.Equal(t, "gin-service.http_port", FlagName("gin-service", "http_port"))
+}
+
+func TestBindConfigFlags(t *testing.T) {
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	BindConfigFlags(fs)
+	assert.Equal(t, "int64", fs.Lookup("flags-test.http_port").Value.Type())
+	assert.Equal(t, "stringSlice", fs.Lookup("flags-test.hosts").Value.Type())
+	assert.Equal(t, "bool", fs.Lookup("flags-test.health.enable").Value.Type())
+	assert.Equal(t, "duration", fs.Lookup("flags-test.health.timeout").Value.Type())
+	assert.Nil(t, fs.Lookup("flags-test.labels"))
+	assert.Contains(t, fs.Lookup("flags-test.http_port").Usage, "FLAGS_TEST_HTTP_PORT")
+}
+
+func TestConfigFlags(t *testing.T) {
+	t.Setenv("FLAGS_TEST_HTTP_PORT", "8081")
+	t.Setenv("FLAGS_TEST_HEALTH_ENABLE", "true")
+	t.Setenv("FLAGS_TEST_HOSTS", "a,b")
+
+	c := NewContainer()
+	defer c.Close()
+	assert.NoError(t, c.LoadConfigMap(map[string]map[string]any{
+		"flags-test": {"http_port": 8080, "labels": map[string]any{"team": "core"}},
+	}))
+
+	var cfg flagsConfig
+	assert.NoError(t, c.UnmarshalConfig("flags-test", &cfg, nil))
+	assert.Equal(t, flagsConfig{
+		HttpPort: 8081,
+		Hosts:    []string{"a", "b"},
+		Health:   flagsHealthConfig{Enable: true},
+		Labels:   map[string]string{"team": "core"},
+	}, cfg)
+
+	var changes []*ConfigChange
+	assert.NoError(t, c.AddConfigAuditSink(AuditSinkFunc(func(change *ConfigChange) {
+		changes = append(changes, change)
+	})))
+
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	BindConfigFlags(fs)
+	assert.NoError(t, fs.Parse([]string{"--flags-test.http_port=9090", "--flags-test.health.timeout=2s"}))
+	assert.NoError(t, c.SetConfigFlags(fs))
+
+	cfg = flagsConfig{}
+	assert.NoError(t, c.UnmarshalConfig("flags-test", &cfg, nil))
+	assert.Equal(t, 9090, cfg.HttpPort)
+	assert.Equal(t, 2*time.Second, cfg.Health.Timeout)
+	assert.True(t, cfg.Health.Enable)
+	if assert.Len(t, changes, 1) {
+		origins := map[string]string{}
+		for _, k := range changes[0].Keys {
+			origins[k.Key] = k.Origin
+		}
+		assert.Equal(t, map[string]string{
+			"http_port":      "flag --flags-test.http_port",
+			"health.timeout": "flag --flags-test.health.timeout",
+		}, origins)
+	}
+
+	// flags set before the config is loaded apply to it
+	c2 := NewContainer()
+	defer c2.Close()
+	assert.NoError(t, c2.SetConfigFlags(fs))
+	assert.NoError(t, c2.LoadConfigMap(map[string]map[string]any{"flags-test": {}}))
+	cfg = flagsConfig{}
+	assert.NoError(t, c2.UnmarshalConfig("flags-test", &cfg, nil))
+	assert.Equal(t, 9090, cfg.HttpPort)
+}
@@ -0,0 +1,151 @@
+package ioc
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+type providerMeta struct {
+	builds        int
+	failures      int
+	lastBuild     time.Time
+	buildDuration time.Duration
+	configs       []string
+}
+
+// Graph describes the providers a container has resolved.
+type Graph struct {
+	Providers []*GraphNode `json:"providers"`
+}
+
+type GraphNode struct {
+	Name           string        `json:"name"`
+	Instantiated   bool          `json:"instantiated"`
+	Builds         int           `json:"builds"`
+	Failures       int           `json:"failures"`
+	LastBuild      time.Time     `json:"last_build,omitempty"`
+	BuildDuration  time.Duration `json:"build_duration_ns"`
+	ConfigSections []string      `json:"config_sections,omitempty"`
+	DependsOn      []string      `json:"depends_on,omitempty"`
+}
+
+func (c *container) recordBuild(p injector, started time.Time, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := c.metaOf(p)
+	m.builds++
+	if err != nil {
+		m.failures++
+	}
+	m.lastBuild = started
+	m.buildDuration = time.Since(started)
+}
+
+// recordConfig notes that the factory c was handed to loads section name.
+func (c *Container) recordConfig(name string) {
+	if c.frame == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := c.metaOf(c.frame.p)
+	if !slices.Contains(m.configs, name) {
+		m.configs = append(m.configs, name)
+	}
+}
+
+// metaOf returns the metadata of p, c.mu must be held.
+func (c *container) metaOf(p injector) *providerMeta {
+	m, ok := c.meta[p]
+	if !ok {
+		m = &providerMeta{}
+		c.meta[p] = m
+	}
+	return m
+}
+
+// Graph returns the providers resolved through c, the config sections they
+// loaded, how long they took to construct and which providers they
+// resolved in their factories.
+func (c *Container) Graph() *Graph {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	nodes := map[injector]*GraphNode{}
+	node := func(p injector) *GraphNode {
+		n, ok := nodes[p]
+		if !ok {
+			_, instantiated := c.instances[p]
+			n = &GraphNode{Name: p.String(), Instantiated: instantiated}
+			nodes[p] = n
+		}
+		return n
+	}
+	for p, m := range c.meta {
+		n := node(p)
+		n.Builds = m.builds
+		n.Failures = m.failures
+		n.LastBuild = m.lastBuild
+		n.BuildDuration = m.buildDuration
+		n.ConfigSections = slices.Clone(m.configs)
+	}
+	for p := range c.instances {
+		node(p)
+	}
+	for p, deps := range c.deps {
+		n := node(p)
+		for d := range deps {
+			n.DependsOn = append(n.DependsOn, node(d).Name)
+		}
+		slices.Sort(n.DependsOn)
+	}
+
+	g := &Graph{}
+	for _, n := range nodes {
+		g.Providers = append(g.Providers, n)
+	}
+	slices.SortFunc(g.Providers, func(a, b *GraphNode) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return g
+}
+
+func (g *Graph) JSON() ([]byte, error) {
+	return json.MarshalIndent(g, "", "  ")
+}
+
+// DOT renders the graph in Graphviz format, with an edge from every
+// provider to each of its dependencies.
+func (g *Graph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph ioc {\n")
+	b.WriteString("\trankdir=LR;\n")
+	b.WriteString("\tnode [shape=box];\n")
+	for _, n := range g.Providers {
+		label := n.Name
+		if len(n.ConfigSections) > 0 {
+			label += "\\nconfig: " + strings.Join(n.ConfigSections, ", ")
+		}
+		if n.Builds > 0 {
+			label += fmt.Sprintf("\\nbuilt in %s", n.BuildDuration)
+		}
+		style := ""
+		if !n.Instantiated {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(&b, "\t%s [label=%s%s];\n", dotQuote(n.Name), dotQuote(label), style)
+	}
+	for _, n := range g.Providers {
+		for _, d := range n.DependsOn {
+			fmt.Fprintf(&b, "\t%s -> %s;\n", dotQuote(n.Name), dotQuote(d))
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
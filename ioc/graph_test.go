@@ -0,0 +1,70 @@
+package ioc_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aiechoic/services/ioc"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type graphDB struct{ _ int }
+type graphRepo struct{ _ int }
+
+func TestGraph(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "db.test.yaml"), []byte("host: localhost"), 0644)
+	assert.NoError(t, err)
+
+	dbProvider := ioc.NewProvider(func(c *ioc.Container) (*graphDB, error) {
+		var cfg map[string]string
+		err := c.UnmarshalConfig("db", &cfg, nil)
+		return &graphDB{}, err
+	})
+	repoProvider := ioc.NewProvider(func(c *ioc.Container) (*graphRepo, error) {
+		dbProvider.MustGet(c)
+		return &graphRepo{}, nil
+	})
+
+	c := ioc.NewContainer()
+	assert.NoError(t, c.LoadConfig(dir, ioc.ConfigEnvTest))
+	repoProvider.MustGet(c)
+
+	g := c.Graph()
+	assert.Len(t, g.Providers, 2)
+	db, repo := g.Providers[0], g.Providers[1]
+	assert.Equal(t, dbProvider.String(), db.Name)
+	assert.True(t, db.Instantiated)
+	assert.Equal(t, 1, db.Builds)
+	assert.Equal(t, []string{"db"}, db.ConfigSections)
+	assert.Equal(t, []string{db.Name}, repo.DependsOn)
+
+	data, err := g.JSON()
+	assert.NoError(t, err)
+	var decoded ioc.Graph
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, repo.DependsOn, decoded.Providers[1].DependsOn)
+
+	dot := g.DOT()
+	assert.Contains(t, dot, fmt.Sprintf("%q -> %q;", repoProvider, dbProvider))
+	assert.Contains(t, dot, `config: db`)
+}
+
+func TestGraph_ProvidersOfSameType(t *testing.T) {
+	var providers []*ioc.Provider[*graphDB]
+	for range 2 {
+		providers = append(providers, ioc.NewProvider(func(c *ioc.Container) (*graphDB, error) {
+			return &graphDB{}, nil
+		}))
+	}
+	assert.NotEqual(t, providers[0].String(), providers[1].String())
+
+	c := ioc.NewContainer()
+	defer c.Close()
+	for _, p := range providers {
+		p.MustGet(c)
+	}
+	assert.Len(t, c.Graph().Providers, 2)
+}
@@ -0,0 +1,154 @@
+package ioc
+
+import (
+	"context"
+	"fmt"
+	"github.com/aiechoic/services/ioc/healthy"
+	"slices"
+	"sync"
+	"time"
+)
+
+// healthHistorySize is the number of reports kept per health check.
+const healthHistorySize = 64
+
+type healthChecker struct {
+	component   string
+	pkg         string
+	check       func() *healthy.Error
+	lastSuccess time.Time
+	failures    int
+	history     []*healthy.Report
+	mu          sync.Mutex
+}
+
+func (c *Container) onHealthCheck(component, location string, checker func() *healthy.Error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	name := component
+	for i := 2; c.hasHealthChecker(name); i++ {
+		name = fmt.Sprintf("%s#%d", component, i)
+	}
+	c.healthCheckers = append(c.healthCheckers, &healthChecker{
+		component: name,
+		pkg:       location,
+		check:     checker,
+	})
+}
+
+// onHealthCheckOnce is like onHealthCheck, but does nothing when a check
+// named component exists.
+func (c *container) onHealthCheckOnce(component, location string, checker func() *healthy.Error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.hasHealthChecker(component) {
+		return
+	}
+	c.healthCheckers = append(c.healthCheckers, &healthChecker{
+		component: component,
+		pkg:       location,
+		check:     checker,
+	})
+}
+
+// hasHealthChecker reports whether a check named component exists, c.mu
+// must be held.
+func (c *container) hasHealthChecker(component string) bool {
+	for _, h := range c.healthCheckers {
+		if h.component == component {
+			return true
+		}
+	}
+	return false
+}
+
+// run runs the check once, bounded by ctx, and records the report.
+func (h *healthChecker) run(ctx context.Context) *healthy.Report {
+	started := time.Now()
+	errChan := make(chan *healthy.Error, 1)
+	go func() {
+		errChan <- h.check()
+	}()
+
+	var err *healthy.Error
+	select {
+	case err = <-errChan:
+	case <-ctx.Done():
+		err = &healthy.Error{
+			Level: healthy.LError,
+			Msg:   fmt.Sprintf("%s: %s", h.pkg, ctx.Err()),
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	report := &healthy.Report{
+		Component: h.component,
+		Status:    healthy.StatusOK,
+		Latency:   time.Since(started),
+		CheckedAt: started,
+	}
+	if err != nil {
+		h.failures++
+		report.Status = healthy.StatusFailing
+		report.Level = err.Level
+		report.Msg = err.Msg
+	} else {
+		h.failures = 0
+		h.lastSuccess = started
+	}
+	report.LastSuccess = h.lastSuccess
+	report.ConsecutiveFailures = h.failures
+	h.history = append(h.history, report)
+	if len(h.history) > healthHistorySize {
+		h.history = h.history[len(h.history)-healthHistorySize:]
+	}
+	return report
+}
+
+// CheckHealthReports runs every health check in parallel and returns one
+// report per check, in registration order. Checks still running when ctx
+// is done are reported as failing. Nothing is checked if ctx is already
+// done.
+func (c *Container) CheckHealthReports(ctx context.Context) []*healthy.Report {
+	m := c.meter()
+	// checks may read the container, so they run without c.mu
+	c.mu.Lock()
+	checkers := slices.Clone(c.healthCheckers)
+	c.mu.Unlock()
+
+	// Check if context is done
+	select {
+	case <-ctx.Done():
+		return nil
+	default:
+	}
+
+	var wg sync.WaitGroup
+	reports := make([]*healthy.Report, len(checkers))
+	for i, checker := range checkers {
+		wg.Add(1)
+		go func(i int, checker *healthChecker) {
+			defer wg.Done()
+			reports[i] = checker.run(ctx)
+			m.HealthCheck(reports[i])
+		}(i, checker)
+	}
+
+	wg.Wait()
+	return reports
+}
+
+// HealthHistory returns the most recent reports of every health check,
+// oldest first, keyed by component name.
+func (c *Container) HealthHistory() map[string][]*healthy.Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	history := make(map[string][]*healthy.Report, len(c.healthCheckers))
+	for _, h := range c.healthCheckers {
+		h.mu.Lock()
+		history[h.component] = append([]*healthy.Report(nil), h.history...)
+		h.mu.Unlock()
+	}
+	return history
+}
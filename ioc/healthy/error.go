@@ -28,8 +28,9 @@ func (e Level) Number() int {
 }
 
 type Error struct {
-	Level Level
-	Msg   string
+	Component string // set by the container to the name of the check
+	Level     Level
+	Msg       string
 }
 
 func (e *Error) Error() string {
@@ -0,0 +1,34 @@
+package healthy
+
+import "time"
+
+type Status string
+
+const (
+	StatusOK      Status = "ok"
+	StatusFailing Status = "failing"
+)
+
+// Report is the outcome of one run of a named health check.
+type Report struct {
+	Component           string        `json:"component"`
+	Status              Status        `json:"status"`
+	Level               Level         `json:"level,omitempty"`
+	Msg                 string        `json:"msg,omitempty"`
+	Latency             time.Duration `json:"latency_ns"`
+	CheckedAt           time.Time     `json:"checked_at"`
+	LastSuccess         time.Time     `json:"last_success,omitempty"`
+	ConsecutiveFailures int           `json:"consecutive_failures"`
+}
+
+// Err returns the report as an Error, or nil when the check passed.
+func (r *Report) Err() *Error {
+	if r.Status == StatusOK {
+		return nil
+	}
+	return &Error{
+		Component: r.Component,
+		Level:     r.Level,
+		Msg:       r.Msg,
+	}
+}
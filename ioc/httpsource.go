@@ -0,0 +1,84 @@
+package ioc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// HTTPSource loads config sections from an HTTP endpoint answering a JSON,
+// YAML or TOML document keyed by section:
+//
+//	{"redis": {"host": "cache.internal"}, "email-sender": {"port": "465"}}
+//
+// Requests are conditional on the ETag of the last response, so the endpoint
+// may hold them until its content changes (long polling); add the source
+// with a zero interval then.
+type HTTPSource struct {
+	URL    string
+	Client *http.Client // http.DefaultClient when nil
+	Header http.Header
+
+	etag string
+	last map[string]map[string]any
+	mu   sync.Mutex
+}
+
+func NewHTTPSource(url string) *HTTPSource {
+	return &HTTPSource{URL: url}
+}
+
+func (s *HTTPSource) String() string {
+	return s.URL
+}
+
+func (s *HTTPSource) Load(ctx context.Context) (map[string]map[string]any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range s.Header {
+		req.Header[k] = v
+	}
+	if s.etag != "" && s.last != nil {
+		req.Header.Set("If-None-Match", s.etag)
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return s.last, nil
+	case http.StatusOK:
+	default:
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := DecodeConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	sections := map[string]map[string]any{}
+	for name, v := range doc {
+		section, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("section \"%s\" is not an object", name)
+		}
+		sections[name] = section
+	}
+	s.etag, s.last = resp.Header.Get("ETag"), sections
+	return sections, nil
+}
@@ -0,0 +1,99 @@
+package ioc
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// ConfigInstancesKey is the key under which a section declares named
+// instances, each overriding the settings of the section outside it:
+//
+//	host: localhost
+//	instances:
+//	  cache: {db: 1}
+//	  queue: {host: queue.internal}
+const ConfigInstancesKey = "instances"
+
+// InstanceName names instance of section, for example "redis.cache".
+func InstanceName(section, instance string) string {
+	return section + "." + instance
+}
+
+// Instances returns the sorted names of the instances declared by section
+// name, creating the section from defaultContent when it does not exist.
+func (c *Vipers) Instances(name string, defaultContent []byte) ([]string, error) {
+	vp, err := c.GetOrCreateViper(name, defaultContent)
+	if err != nil {
+		return nil, err
+	}
+	instances, _ := vp.Get(ConfigInstancesKey).(map[string]any)
+	names := make([]string, 0, len(instances))
+	for instance := range instances {
+		names = append(names, instance)
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// UnmarshalInstance decodes instance of section name into v, from the
+// settings of the section outside ConfigInstancesKey deep-merged with those
+// of the instance.
+func (c *Vipers) UnmarshalInstance(name, instance string, v any, defaultContent []byte) error {
+	vp, err := c.GetOrCreateViper(name, defaultContent)
+	if err != nil {
+		return err
+	}
+	settings := vp.AllSettings()
+	instances, _ := settings[ConfigInstancesKey].(map[string]any)
+	key := strings.ToLower(instance)
+	own, ok := instances[key].(map[string]any)
+	if !ok {
+		return fmt.Errorf("config \"%s\": no instance \"%s\" declared", c.describe(name), instance)
+	}
+	delete(settings, ConfigInstancesKey)
+
+	t := reflect.TypeOf(v)
+	unknown := unknownConfigKeys(t, settings, "")
+	unknown = append(unknown, unknownConfigKeys(t, own, joinKey(ConfigInstancesKey, key))...)
+	if len(unknown) > 0 {
+		return c.unknownKeysError(name, unknown)
+	}
+	mergeSettings(settings, own)
+	// settings already hold the environment variables and flags of the
+	// section; reading them again would override the instance settings
+	ivp := viper.New()
+	err = ivp.MergeConfigMap(settings)
+	if err != nil {
+		return err
+	}
+	err = ivp.Unmarshal(v)
+	if err != nil {
+		return fmt.Errorf("unmarshalling config \"%s\" instance \"%s\": %w", c.describe(name), instance, err)
+	}
+	return nil
+}
+
+// ConfigInstances returns the sorted names of the instances declared by
+// config section name.
+func (c *Container) ConfigInstances(name string, defaultContent []byte) ([]string, error) {
+	c.recordConfig(name)
+	vipers, err := c.config()
+	if err != nil {
+		return nil, err
+	}
+	return vipers.Instances(name, defaultContent)
+}
+
+// UnmarshalInstanceConfig decodes instance of config section name into v,
+// see Vipers.UnmarshalInstance.
+func (c *Container) UnmarshalInstanceConfig(name, instance string, v any, defaultContent []byte) error {
+	c.recordConfig(name)
+	vipers, err := c.config()
+	if err != nil {
+		return err
+	}
+	return vipers.UnmarshalInstance(name, instance, v, defaultContent)
+}
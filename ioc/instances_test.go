@@ -0,0 +1,87 @@
+package ioc
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type instanceConfig struct {
+	Host string `mapstructure:"host"`
+	DB   int    `mapstructure:"db"`
+}
+
+type instanceClient struct {
+	name string
+	cfg  instanceConfig
+}
+
+func TestProviders_Instances(t *testing.T) {
+	c := NewContainer()
+	defer c.Close()
+	assert.NoError(t, c.LoadConfigMap(map[string]map[string]any{
+		"store": {
+			"host": "localhost",
+			"instances": map[string]any{
+				"cache": map[string]any{"db": 1},
+				"queue": map[string]any{"host": "queue.internal", "db": 2},
+				"bad":   map[string]any{"port": 1},
+			},
+		},
+	}))
+
+	// the section itself still decodes, ignoring its instances
+	var base instanceConfig
+	assert.NoError(t, c.UnmarshalConfig("store", &base, nil))
+	assert.Equal(t, instanceConfig{Host: "localhost"}, base)
+
+	names, err := c.ConfigInstances("store", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bad", "cache", "queue"}, names)
+
+	providers := NewProviders[*instanceClient]().WithHealthCheck(func(ins *instanceClient) error {
+		if ins.cfg.DB == 2 {
+			return errors.New("queue is down")
+		}
+		return nil
+	})
+	newClient := func(c *Container, instance string) (*instanceClient, error) {
+		var cfg instanceConfig
+		if err := c.UnmarshalInstanceConfig("store", instance, &cfg, nil); err != nil {
+			return nil, err
+		}
+		return &instanceClient{name: instance, cfg: cfg}, nil
+	}
+
+	pvds, err := providers.InstanceProviders(c, "store", nil, newClient)
+	assert.NoError(t, err)
+	assert.Len(t, pvds, 3)
+	assert.Equal(t, `Providers[*ioc.instanceClient]("store.cache")`, pvds[1].String())
+
+	clients, err := providers.GetInstances(c, "store", nil, newClient)
+	assert.ErrorIs(t, err, ErrUnknownConfigKeys)
+	assert.ErrorContains(t, err, `"instances.bad.port"`)
+	assert.Len(t, clients, 2)
+	assert.Equal(t, instanceConfig{Host: "localhost", DB: 1}, clients["cache"].cfg)
+	assert.Equal(t, instanceConfig{Host: "queue.internal", DB: 2}, clients["queue"].cfg)
+	assert.Same(t, clients["cache"], providers.GetInstanceProvider("store", "cache", newClient).MustGet(c))
+
+	errs := c.CheckHealth(context.Background())
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, `Providers[*ioc.instanceClient]("store.queue")`, errs[0].Component)
+		assert.Equal(t, "queue is down", errs[0].Msg)
+	}
+
+	// refreshing an instance checks the new one instead of adding a check
+	cache := providers.GetInstanceProvider("store", "cache", newClient)
+	refreshed := cache.MustRefresh(c)
+	assert.NotSame(t, clients["cache"], refreshed)
+	assert.NotNil(t, cache.MustGetNew(c))
+	reports := c.CheckHealthReports(context.Background())
+	assert.Len(t, reports, 2)
+
+	err = c.UnmarshalInstanceConfig("store", "missing", &base, nil)
+	assert.ErrorContains(t, err, `no instance "missing" declared`)
+}
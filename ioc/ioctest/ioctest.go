@@ -0,0 +1,48 @@
+// Package ioctest builds ioc containers for tests.
+package ioctest
+
+import (
+	"fmt"
+	"github.com/aiechoic/services/ioc"
+	"testing"
+)
+
+// New returns a container loaded with the given config sections and closed
+// when the test ends. Only overridden providers, the allowed ones and
+// ioc.LoggerProvider, which the built-in packages resolve through
+// ioc.GetLogger, may be constructed; resolving any other provider fails the
+// test and returns an error to the caller of Get.
+func New(t testing.TB, sections map[string]map[string]any, allowed ...fmt.Stringer) *ioc.Container {
+	t.Helper()
+	c := ioc.NewContainer()
+	if sections == nil {
+		sections = map[string]map[string]any{}
+	}
+	if err := c.LoadConfigMap(sections); err != nil {
+		t.Fatalf("ioctest: load config: %v", err)
+	}
+	allow := map[fmt.Stringer]bool{ioc.LoggerProvider: true}
+	for _, p := range allowed {
+		allow[p] = true
+	}
+	c.SetResolveGuard(func(p fmt.Stringer) error {
+		if allow[p] {
+			return nil
+		}
+		t.Errorf("ioctest: unexpected resolution of %s, override or allow it", p)
+		return fmt.Errorf("ioctest: unexpected resolution of %s", p)
+	})
+	t.Cleanup(func() {
+		if err := c.Close(); err != nil {
+			t.Errorf("ioctest: close container: %v", err)
+		}
+	})
+	return c
+}
+
+// Value returns a factory that always returns v, for use with Override.
+func Value[T any](v T) func(c *ioc.Container) (T, error) {
+	return func(c *ioc.Container) (T, error) {
+		return v, nil
+	}
+}
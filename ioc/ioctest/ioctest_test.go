@@ -0,0 +1,107 @@
+package ioctest_test
+
+import (
+	"github.com/aiechoic/services/ioc"
+	"github.com/aiechoic/services/ioc/ioctest"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type Store struct{ Addr string }
+
+type Service struct{ Store *Store }
+
+var storeProviders = ioc.NewProviders[*Store]()
+
+func getStoreProvider(name string) *ioc.Provider[*Store] {
+	return storeProviders.GetProvider(name, func(c *ioc.Container) (*Store, error) {
+		var cfg struct {
+			Addr string `mapstructure:"addr"`
+		}
+		err := c.UnmarshalConfig(name, &cfg, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &Store{Addr: cfg.Addr}, nil
+	})
+}
+
+var serviceProvider = ioc.NewProvider(func(c *ioc.Container) (*Service, error) {
+	return &Service{Store: getStoreProvider("store").MustGet(c)}, nil
+})
+
+func TestOverride(t *testing.T) {
+	c := ioctest.New(t, nil, serviceProvider)
+	fake := &Store{Addr: "fake"}
+	getStoreProvider("store").Override(c, ioctest.Value(fake))
+
+	assert.True(t, serviceProvider.MustGet(c).Store == fake)
+}
+
+func TestOverrideNamedBeforeRegistration(t *testing.T) {
+	c := ioctest.New(t, nil)
+	fake := &Store{Addr: "fake"}
+	storeProviders.Override(c, "cache", ioctest.Value(fake))
+
+	assert.True(t, getStoreProvider("cache").MustGet(c) == fake)
+}
+
+func TestOverrideOnScope(t *testing.T) {
+	c := ioctest.New(t, nil)
+	scope := c.NewScope()
+	defer scope.Close()
+
+	requestProvider := ioc.NewScopedProvider(func(c *ioc.Container) (*Store, error) {
+		return &Store{Addr: "request"}, nil
+	})
+	fake := &Store{Addr: "fake"}
+	requestProvider.Override(scope, ioctest.Value(fake))
+	assert.True(t, requestProvider.MustGet(scope) == fake)
+
+	assert.Panics(t, func() {
+		getStoreProvider("store").Override(scope, ioctest.Value(fake))
+	})
+}
+
+func TestConfigMap(t *testing.T) {
+	c := ioctest.New(t, map[string]map[string]any{
+		"store": {"addr": "localhost:6379"},
+	}, getStoreProvider("store"), getStoreProvider("missing"))
+
+	assert.Equal(t, "localhost:6379", getStoreProvider("store").MustGet(c).Addr)
+
+	_, err := getStoreProvider("missing").Get(c)
+	assert.Error(t, err)
+}
+
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, format)
+}
+
+func TestUnexpectedResolution(t *testing.T) {
+	r := &recorder{TB: t}
+	c := ioctest.New(r, nil)
+
+	_, err := serviceProvider.Get(c)
+	assert.Error(t, err)
+	assert.Len(t, r.errors, 1)
+}
+
+var loggingProvider = ioc.NewProvider(func(c *ioc.Container) (*Store, error) {
+	ioc.GetLogger(c, "store").Info("connecting")
+	return &Store{}, nil
+})
+
+func TestAllowedProviderLogs(t *testing.T) {
+	r := &recorder{TB: t}
+	c := ioctest.New(r, nil, loggingProvider)
+
+	_, err := loggingProvider.Get(c)
+	assert.NoError(t, err)
+	assert.Empty(t, r.errors)
+}
@@ -0,0 +1,151 @@
+package ioc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// ErrFatal marks a worker error that must stop Run instead of restarting the
+// worker; see Fatal.
+var ErrFatal = errors.New("ioc: fatal worker error")
+
+// Fatal wraps err so that a worker returning it is not restarted: Run shuts
+// the container down and returns err. Use it for errors retrying cannot fix,
+// such as an address already in use.
+func Fatal(err error) error {
+	return fmt.Errorf("%w: %w", ErrFatal, err)
+}
+
+// OnStart registers a long-running worker. Workers are started by Run and
+// must return once ctx is cancelled. A worker that returns an error (or
+// panics) before that is restarted with an exponential backoff; a worker
+// that returns nil is considered finished, and one that returns an error
+// wrapped by Fatal stops Run.
+//
+// Workers registered while Run is in progress are started immediately.
+func (c *Container) OnStart(worker func(ctx context.Context) error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w := &withPkgFunc[closeFunc]{
+		pkg:   getCallerLocation(2),
+		owner: c.owner(),
+		f:     worker,
+	}
+	c.starters = append(c.starters, w)
+	if c.running != nil {
+		c.startWorker(c.running, w)
+	}
+}
+
+// SetRestartBackoff sets the delay bounds used to restart crashed workers.
+func (c *Container) SetRestartBackoff(min, max time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.minBackoff = min
+	c.maxBackoff = max
+}
+
+// Run starts every worker registered with OnStart and blocks until ctx is
+// cancelled, the process receives SIGINT or SIGTERM, or a worker fails with
+// a Fatal error. It then cancels the workers, waits for them to return and
+// closes the container, each within its own default close timeout. The
+// error of a fatal worker is returned along with the close error.
+func (c *Container) Run(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	ctx, fail := context.WithCancelCause(ctx)
+	defer fail(nil)
+
+	c.mu.Lock()
+	if c.state != StateRunning {
+		c.mu.Unlock()
+		return ErrContainerClosed
+	}
+	if c.running != nil {
+		c.mu.Unlock()
+		return fmt.Errorf("ioc: container is already running")
+	}
+	c.running = ctx
+	c.fail = fail
+	for _, w := range c.starters {
+		c.startWorker(ctx, w)
+	}
+	c.mu.Unlock()
+
+	<-ctx.Done()
+	c.logger().Info("shutting down gracefully")
+	c.mu.Lock()
+	c.running = nil
+	c.fail = nil
+	c.mu.Unlock()
+
+	stopCtx, cancelStop := context.WithTimeout(context.Background(), defaultCloseTimeout)
+	defer cancelStop()
+	done := make(chan struct{})
+	go func() {
+		c.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-stopCtx.Done():
+		c.logger().Warn("workers did not stop in time")
+	}
+
+	closeCtx, cancelClose := context.WithTimeout(context.Background(), defaultCloseTimeout)
+	defer cancelClose()
+	err := c.CloseWithContext(closeCtx)
+	if cause := context.Cause(ctx); errors.Is(cause, ErrFatal) {
+		return errors.Join(cause, err)
+	}
+	return err
+}
+
+// startWorker runs w until ctx is cancelled. c.mu must be held.
+func (c *Container) startWorker(ctx context.Context, w *withPkgFunc[closeFunc]) {
+	minBackoff, maxBackoff := c.minBackoff, c.maxBackoff
+	fail := c.fail
+	c.workers.Add(1)
+	go func() {
+		defer c.workers.Done()
+		backoff := minBackoff
+		for {
+			started := time.Now()
+			err := runWorker(ctx, w.f)
+			if ctx.Err() != nil {
+				return
+			}
+			if err == nil {
+				return
+			}
+			if errors.Is(err, ErrFatal) {
+				c.logger().Error("worker failed, stopping", "worker", w.pkg, "error", err)
+				fail(err)
+				return
+			}
+			if time.Since(started) >= maxBackoff {
+				backoff = minBackoff
+			}
+			c.logger().Error("worker failed, restarting", "worker", w.pkg, "error", err, "backoff", backoff)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, maxBackoff)
+		}
+	}()
+}
+
+func runWorker(ctx context.Context, f closeFunc) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return f(ctx)
+}
@@ -0,0 +1,199 @@
+package ioc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+const LoggerConfigSection = "logger"
+
+// LogPackageKey is the attribute naming the package a record comes from,
+// which selects its level among the per-package levels.
+const LogPackageKey = "pkg"
+
+var defaultLoggerConfigData = []byte(
+	`# Logger configuration file
+
+# Minimum level: debug, info, warn or error
+level: "info"
+# Output format: text or json
+format: "text"
+# Minimum level of a package and its sub-packages, overriding level,
+# e.g. "database/redis: debug"
+packages: {}
+`)
+
+func init() {
+	RegisterDefaultConfig(LoggerConfigSection, defaultLoggerConfigData)
+	RegisterConfigType(LoggerConfigSection, LoggerConfig{})
+}
+
+type LoggerConfig struct {
+	Level    string            `mapstructure:"level"`
+	Format   string            `mapstructure:"format"`
+	Packages map[string]string `mapstructure:"packages"`
+}
+
+func (c *LoggerConfig) Validate() error {
+	if c.Format != "" && c.Format != "text" && c.Format != "json" {
+		return fmt.Errorf("unknown log format \"%s\"", c.Format)
+	}
+	_, err := c.levels()
+	return err
+}
+
+func (c *LoggerConfig) levels() (*logLevels, error) {
+	l := &logLevels{packages: map[string]slog.Level{}}
+	if err := parseLogLevel(c.Level, &l.level); err != nil {
+		return nil, err
+	}
+	for pkg, level := range c.Packages {
+		var pl slog.Level
+		if err := parseLogLevel(level, &pl); err != nil {
+			return nil, fmt.Errorf("package %s: %w", pkg, err)
+		}
+		l.packages[pkg] = pl
+	}
+	return l, nil
+}
+
+func parseLogLevel(s string, level *slog.Level) error {
+	if s == "" {
+		*level = slog.LevelInfo
+		return nil
+	}
+	return level.UnmarshalText([]byte(s))
+}
+
+// NewHandler returns the handler writing records to w in the configured
+// format, filtered by the configured levels.
+func (c *LoggerConfig) NewHandler(w io.Writer) (slog.Handler, error) {
+	levels, err := c.levels()
+	if err != nil {
+		return nil, err
+	}
+	h := &levelHandler{levels: &atomic.Pointer[logLevels]{}}
+	h.levels.Store(levels)
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug - 4}
+	if c.Format == "json" {
+		h.Handler = slog.NewJSONHandler(w, opts)
+	} else {
+		h.Handler = slog.NewTextHandler(w, opts)
+	}
+	return h, nil
+}
+
+// LoggerProvider provides the logger of the container, configured by the
+// "logger" section and writing to stderr. Level changes of the section apply
+// without a restart; a format change needs one. A container without a logger
+// section gets a text logger at the info level, and no default file is
+// written for it.
+var LoggerProvider = NewProvider(newLogger)
+
+func newLogger(c *Container) (*slog.Logger, error) {
+	vipers, err := c.config()
+	if err != nil || !vipers.has(LoggerConfigSection) {
+		h, err := (&LoggerConfig{}).NewHandler(os.Stderr)
+		if err != nil {
+			return nil, err
+		}
+		return slog.New(h), nil
+	}
+	var handler *levelHandler
+	err = WatchTyped(c, LoggerConfigSection, defaultLoggerConfigData, func(cfg *LoggerConfig) error {
+		if handler == nil {
+			h, err := cfg.NewHandler(os.Stderr)
+			if err != nil {
+				return err
+			}
+			handler = h.(*levelHandler)
+			return nil
+		}
+		levels, err := cfg.levels()
+		if err != nil {
+			return err
+		}
+		handler.levels.Store(levels)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	logger := slog.New(handler)
+	vipers.SetLogger(logger.With(LogPackageKey, "ioc"))
+	c.root().log.Store(logger)
+	return logger, nil
+}
+
+// GetLogger returns the logger of c for package pkg. It falls back to
+// slog.Default when the logger cannot be built, for example when the logger
+// section is invalid.
+func GetLogger(c *Container, pkg string) *slog.Logger {
+	logger, err := LoggerProvider.Get(c)
+	if err != nil {
+		logger = slog.Default()
+	} else {
+		c.root().log.Store(logger)
+	}
+	return logger.With(LogPackageKey, pkg)
+}
+
+// logger returns the logger of c for the ioc package without building it,
+// so that the container can log from anywhere.
+func (c *Container) logger() *slog.Logger {
+	if l := c.root().log.Load(); l != nil {
+		return l.With(LogPackageKey, "ioc")
+	}
+	return slog.Default().With(LogPackageKey, "ioc")
+}
+
+type logLevels struct {
+	level    slog.Level
+	packages map[string]slog.Level
+}
+
+// of returns the level of pkg, set for pkg itself or its closest parent.
+func (l *logLevels) of(pkg string) slog.Level {
+	for pkg != "" {
+		if level, ok := l.packages[pkg]; ok {
+			return level
+		}
+		i := strings.LastIndex(pkg, "/")
+		if i < 0 {
+			break
+		}
+		pkg = pkg[:i]
+	}
+	return l.level
+}
+
+// levelHandler filters records by the level of the package named by their
+// LogPackageKey attribute.
+type levelHandler struct {
+	slog.Handler
+	levels *atomic.Pointer[logLevels]
+	pkg    string
+}
+
+func (h *levelHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.levels.Load().of(h.pkg)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	pkg := h.pkg
+	for _, a := range attrs {
+		if a.Key == LogPackageKey {
+			pkg = a.Value.String()
+		}
+	}
+	return &levelHandler{Handler: h.Handler.WithAttrs(attrs), levels: h.levels, pkg: pkg}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithGroup(name), levels: h.levels, pkg: h.pkg}
+}
@@ -0,0 +1,82 @@
+package ioc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoggerConfig_NewHandler(t *testing.T) {
+	cfg := &LoggerConfig{
+		Level:    "warn",
+		Format:   "json",
+		Packages: map[string]string{"database": "debug", "database/gorm": "error"},
+	}
+	assert.NoError(t, cfg.Validate())
+	var buf bytes.Buffer
+	h, err := cfg.NewHandler(&buf)
+	assert.NoError(t, err)
+	logger := slog.New(h)
+
+	logger.With(LogPackageKey, "gins").Info("dropped")
+	logger.With(LogPackageKey, "gins").Warn("kept", "n", 1)
+	logger.With(LogPackageKey, "database/redis").Debug("kept")
+	logger.With(LogPackageKey, "database/gorm").Warn("dropped")
+
+	var records []map[string]any
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var r map[string]any
+		assert.NoError(t, dec.Decode(&r))
+		records = append(records, r)
+	}
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, "gins", records[0][LogPackageKey])
+		assert.Equal(t, float64(1), records[0]["n"])
+		assert.Equal(t, "database/redis", records[1][LogPackageKey])
+	}
+
+	assert.Error(t, (&LoggerConfig{Format: "xml"}).Validate())
+	assert.Error(t, (&LoggerConfig{Packages: map[string]string{"gins": "loud"}}).Validate())
+}
+
+func TestLoggerProvider(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "logger.test.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("level: info\n"), 0644))
+
+	c := NewContainer()
+	defer c.Close()
+	assert.NoError(t, c.LoadConfig(dir, ConfigEnvTest))
+
+	logger := GetLogger(c, "redis")
+	assert.False(t, logger.Enabled(context.Background(), slog.LevelDebug))
+	assert.NoError(t, os.WriteFile(file, []byte("level: info\npackages:\n  redis: debug\n"), 0644))
+	assert.Eventually(t, func() bool {
+		return logger.Enabled(context.Background(), slog.LevelDebug)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.False(t, GetLogger(c, "gins").Enabled(context.Background(), slog.LevelDebug))
+
+	// without config, a logger at the info level is built
+	logger = GetLogger(NewContainer(), "redis")
+	assert.True(t, logger.Enabled(context.Background(), slog.LevelInfo))
+	assert.False(t, logger.Enabled(context.Background(), slog.LevelDebug))
+
+	// without a logger section, no default file is written
+	empty := t.TempDir()
+	c = NewContainer()
+	defer c.Close()
+	assert.NoError(t, c.LoadConfig(empty, ConfigEnvTest))
+	logger = GetLogger(c, "redis")
+	assert.True(t, logger.Enabled(context.Background(), slog.LevelInfo))
+	entries, err := os.ReadDir(empty)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
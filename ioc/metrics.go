@@ -0,0 +1,60 @@
+package ioc
+
+import (
+	"github.com/aiechoic/services/ioc/healthy"
+	"time"
+)
+
+type ProviderMethod string
+
+const (
+	ProviderGetNew  ProviderMethod = "get_new"
+	ProviderRefresh ProviderMethod = "refresh"
+)
+
+// Metrics receives the measurements of a container. Implementations must be
+// safe for concurrent use; see PrometheusMetrics.
+type Metrics interface {
+	// ProviderCall counts a GetNew or Refresh call of provider.
+	ProviderCall(provider string, method ProviderMethod)
+	// ProviderBuild observes a construction by provider, including the
+	// dependencies it resolved and its decorators.
+	ProviderBuild(provider string, d time.Duration, err error)
+	// HealthCheck observes the report of one run of a health check.
+	HealthCheck(report *healthy.Report)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) ProviderCall(string, ProviderMethod)        {}
+func (nopMetrics) ProviderBuild(string, time.Duration, error) {}
+func (nopMetrics) HealthCheck(*healthy.Report)                {}
+
+// SetMetrics sends the measurements of the container and its scopes to m
+// from now on. Set it before resolving providers to observe every build.
+func (c *Container) SetMetrics(m Metrics) {
+	r := c.root()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = m
+}
+
+// Metrics returns the metrics set with SetMetrics, or nil.
+func (c *Container) Metrics() Metrics {
+	r := c.root()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.metrics
+}
+
+// meter returns the metrics of the container, discarding them when none
+// are set.
+func (c *container) meter() Metrics {
+	r := c.root()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.metrics == nil {
+		return nopMetrics{}
+	}
+	return r.metrics
+}
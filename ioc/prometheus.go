@@ -0,0 +1,203 @@
+package ioc
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/aiechoic/services/ioc/healthy"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// buildBuckets are the upper bounds, in seconds, of the build duration
+// histogram.
+var buildBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10}
+
+type callKey struct {
+	provider string
+	method   ProviderMethod
+}
+
+type buildStats struct {
+	failures uint64
+	sum      float64
+	buckets  []uint64 // cumulative counts of buildBuckets, then +Inf
+}
+
+type healthStats struct {
+	checks   uint64
+	failures uint64
+	up       bool
+}
+
+// PrometheusMetrics keeps the measurements of a container in memory and
+// serves them in the Prometheus text format:
+//
+//	ioc_provider_calls_total{provider,method}
+//	ioc_provider_builds_total{provider}
+//	ioc_provider_build_failures_total{provider}
+//	ioc_provider_build_duration_seconds{provider} (histogram)
+//	ioc_health_checks_total{component}
+//	ioc_health_check_failures_total{component}
+//	ioc_health_check_up{component}
+type PrometheusMetrics struct {
+	calls  map[callKey]uint64
+	builds map[string]*buildStats
+	health map[string]*healthStats
+	mu     sync.Mutex
+}
+
+func NewPrometheusMetrics() *PrometheusMetrics {
+	return &PrometheusMetrics{
+		calls:  map[callKey]uint64{},
+		builds: map[string]*buildStats{},
+		health: map[string]*healthStats{},
+	}
+}
+
+func (m *PrometheusMetrics) ProviderCall(provider string, method ProviderMethod) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls[callKey{provider, method}]++
+}
+
+func (m *PrometheusMetrics) ProviderBuild(provider string, d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.builds[provider]
+	if !ok {
+		s = &buildStats{buckets: make([]uint64, len(buildBuckets)+1)}
+		m.builds[provider] = s
+	}
+	if err != nil {
+		s.failures++
+	}
+	seconds := d.Seconds()
+	s.sum += seconds
+	for i, le := range buildBuckets {
+		if seconds <= le {
+			s.buckets[i]++
+		}
+	}
+	s.buckets[len(buildBuckets)]++
+}
+
+func (m *PrometheusMetrics) HealthCheck(report *healthy.Report) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.health[report.Component]
+	if !ok {
+		s = &healthStats{}
+		m.health[report.Component] = s
+	}
+	s.checks++
+	s.up = report.Status == healthy.StatusOK
+	if !s.up {
+		s.failures++
+	}
+}
+
+// WriteText writes the metrics to w in the Prometheus text format, sorted
+// by label.
+func (m *PrometheusMetrics) WriteText(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b := bufio.NewWriter(w)
+
+	calls := make([]callKey, 0, len(m.calls))
+	for k := range m.calls {
+		calls = append(calls, k)
+	}
+	slices.SortFunc(calls, func(a, b callKey) int {
+		if c := strings.Compare(a.provider, b.provider); c != 0 {
+			return c
+		}
+		return strings.Compare(string(a.method), string(b.method))
+	})
+	writeHeader(b, "ioc_provider_calls_total", "counter", "GetNew and Refresh calls of the providers.")
+	for _, k := range calls {
+		writeSample(b, "ioc_provider_calls_total", m.calls[k], "provider", k.provider, "method", string(k.method))
+	}
+
+	providers := sortedKeys(m.builds)
+	writeHeader(b, "ioc_provider_builds_total", "counter", "Instances constructed by the providers.")
+	for _, p := range providers {
+		writeSample(b, "ioc_provider_builds_total", m.builds[p].buckets[len(buildBuckets)], "provider", p)
+	}
+	writeHeader(b, "ioc_provider_build_failures_total", "counter", "Failed constructions of the providers.")
+	for _, p := range providers {
+		writeSample(b, "ioc_provider_build_failures_total", m.builds[p].failures, "provider", p)
+	}
+	writeHeader(b, "ioc_provider_build_duration_seconds", "histogram", "Duration of the constructions of the providers.")
+	for _, p := range providers {
+		s := m.builds[p]
+		for i, le := range buildBuckets {
+			writeSample(b, "ioc_provider_build_duration_seconds_bucket", s.buckets[i],
+				"provider", p, "le", strconv.FormatFloat(le, 'g', -1, 64))
+		}
+		writeSample(b, "ioc_provider_build_duration_seconds_bucket", s.buckets[len(buildBuckets)], "provider", p, "le", "+Inf")
+		writeSample(b, "ioc_provider_build_duration_seconds_sum", s.sum, "provider", p)
+		writeSample(b, "ioc_provider_build_duration_seconds_count", s.buckets[len(buildBuckets)], "provider", p)
+	}
+
+	components := sortedKeys(m.health)
+	writeHeader(b, "ioc_health_checks_total", "counter", "Runs of the health checks.")
+	for _, c := range components {
+		writeSample(b, "ioc_health_checks_total", m.health[c].checks, "component", c)
+	}
+	writeHeader(b, "ioc_health_check_failures_total", "counter", "Failed runs of the health checks.")
+	for _, c := range components {
+		writeSample(b, "ioc_health_check_failures_total", m.health[c].failures, "component", c)
+	}
+	writeHeader(b, "ioc_health_check_up", "gauge", "Whether the last run of the health check succeeded.")
+	for _, c := range components {
+		up := 0
+		if m.health[c].up {
+			up = 1
+		}
+		writeSample(b, "ioc_health_check_up", up, "component", c)
+	}
+	return b.Flush()
+}
+
+// ServeHTTP serves the metrics to a Prometheus scraper.
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = m.WriteText(w)
+}
+
+func writeHeader(w io.Writer, name, typ, help string) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// writeSample writes one sample of name with the label name and value
+// pairs of labels.
+func writeSample(w io.Writer, name string, value any, labels ...string) {
+	parts := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		parts = append(parts, fmt.Sprintf("%s=\"%s\"", labels[i], escapeLabel(labels[i+1])))
+	}
+	if f, ok := value.(float64); ok {
+		value = strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	_, _ = fmt.Fprintf(w, "%s{%s} %v\n", name, strings.Join(parts, ","), value)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,66 @@
+package ioc
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aiechoic/services/ioc/healthy"
+	"github.com/stretchr/testify/assert"
+)
+
+type meteredService struct{}
+
+func TestPrometheusMetrics(t *testing.T) {
+	ok := NewProvider(func(c *Container) (*meteredService, error) {
+		return &meteredService{}, nil
+	})
+	failing := NewProvider(func(c *Container) (string, error) {
+		return "", errors.New("boom")
+	})
+
+	c := NewContainer()
+	defer c.Close()
+	m := NewPrometheusMetrics()
+	c.SetMetrics(m)
+
+	ok.MustGet(c)
+	ok.MustGetNew(c)
+	ok.MustGetNew(c)
+	ok.MustRefresh(c)
+	_, err := failing.Get(c)
+	assert.Error(t, err)
+
+	up := true
+	c.OnNamedHealthCheck(`db "main"`, func() *healthy.Error {
+		if up {
+			return nil
+		}
+		return &healthy.Error{Level: healthy.LError, Msg: "down"}
+	})
+	c.CheckHealth(context.Background())
+	up = false
+	c.CheckHealth(context.Background())
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	out := rec.Body.String()
+	for _, line := range []string{
+		`# TYPE ioc_provider_calls_total counter`,
+		`ioc_provider_calls_total{provider="` + ok.String() + `",method="get_new"} 2`,
+		`ioc_provider_calls_total{provider="` + ok.String() + `",method="refresh"} 1`,
+		`ioc_provider_builds_total{provider="` + ok.String() + `"} 4`,
+		`ioc_provider_builds_total{provider="` + failing.String() + `"} 1`,
+		`ioc_provider_build_failures_total{provider="` + failing.String() + `"} 1`,
+		`ioc_provider_build_duration_seconds_bucket{provider="` + failing.String() + `",le="+Inf"} 1`,
+		`ioc_provider_build_duration_seconds_count{provider="` + ok.String() + `"} 4`,
+		`ioc_health_checks_total{component="db \"main\""} 2`,
+		`ioc_health_check_failures_total{component="db \"main\""} 1`,
+		`ioc_health_check_up{component="db \"main\""} 0`,
+	} {
+		assert.Contains(t, strings.Split(out, "\n"), line)
+	}
+}
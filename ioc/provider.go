@@ -2,43 +2,94 @@ package ioc
 
 import (
 	"fmt"
+	"github.com/aiechoic/services/ioc/healthy"
+	"reflect"
 	"sync"
 )
 
 type injector interface {
 	new(c *Container) (any, error)
+	decorate(c *Container, ins any, interceptors []Interceptor) (any, error)
+	isScoped() bool
+	String() string
 }
 
 type Provider[T any] struct {
-	f  func(c *Container) (T, error)
-	mu sync.Mutex
+	f          func(c *Container) (T, error)
+	name       string
+	scoped     bool
+	decorators []func(c *Container, ins T) (T, error)
+	mu         sync.Mutex
 }
 
 func (f *Provider[T]) new(c *Container) (any, error) {
+	if f.f == nil {
+		return nil, fmt.Errorf("ioc: provider %s has no factory", f)
+	}
 	return f.f(c)
 }
 
-func (f *Provider[T]) Get(c *Container) (t T, err error) {
+// Decorate wraps every instance f constructs, through its factory or an
+// override, with decorator. Decorators run in the order they were added,
+// before the interceptors of the container, and apply to Get, GetNew and
+// Refresh alike. Instances constructed before the call are left untouched.
+func (f *Provider[T]) Decorate(decorator func(c *Container, ins T) (T, error)) *Provider[T] {
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	ins, ok := c.get(f)
-	if ok {
-		return ins.(T), nil
-	} else {
-		ins, err = f.new(c)
-		if err != nil {
-			return t, err
+	f.decorators = append(f.decorators, decorator)
+	return f
+}
+
+// decorate applies the decorators of f, then interceptors, to ins.
+func (f *Provider[T]) decorate(c *Container, ins any, interceptors []Interceptor) (any, error) {
+	f.mu.Lock()
+	decorators := f.decorators
+	f.mu.Unlock()
+	t, _ := ins.(T)
+	var err error
+	for _, d := range decorators {
+		if t, err = d(c, t); err != nil {
+			return nil, err
 		}
-		if ins == nil {
-			return t, fmt.Errorf("ioc: provider %T returned nil", f)
+	}
+	ins = t
+	for _, i := range interceptors {
+		if ins, err = i(c, f, ins); err != nil {
+			return nil, err
 		}
-		c.set(f, ins)
-		return ins.(T), nil
+		if _, ok := ins.(T); !ok {
+			return nil, fmt.Errorf("ioc: interceptor returned %T for provider %s", ins, f)
+		}
+	}
+	return ins, nil
+}
+
+func (f *Provider[T]) isScoped() bool {
+	return f.scoped
+}
+
+// String returns the name used to identify the provider in errors, graphs
+// and metrics: Provider[T](<file>:<line>) after the NewProvider call, or
+// Providers[T]("<name>") for a named provider, suffixed with #2, #3... when
+// another provider has the same name.
+func (f *Provider[T]) String() string {
+	return f.name
+}
+
+func (f *Provider[T]) Get(c *Container) (t T, err error) {
+	return f.get(c, getCallerLocation(2))
+}
+
+func (f *Provider[T]) get(c *Container, location string) (t T, err error) {
+	ins, err := c.resolve(f, location, true)
+	if err != nil {
+		return t, err
 	}
+	return ins.(T), nil
 }
 
 func (f *Provider[T]) MustGet(c *Container) T {
-	t, err := f.Get(c)
+	t, err := f.get(c, getCallerLocation(2))
 	if err != nil {
 		panic(err)
 	}
@@ -46,9 +97,17 @@ func (f *Provider[T]) MustGet(c *Container) T {
 }
 
 func (f *Provider[T]) GetNew(c *Container) (T, error) {
-	f.mu.Lock()
-	defer f.mu.Unlock()
-	t, err := f.new(c)
+	return f.getNew(c, getCallerLocation(2))
+}
+
+func (f *Provider[T]) getNew(c *Container, location string) (T, error) {
+	c.meter().ProviderCall(f.String(), ProviderGetNew)
+	return f.build(c, location)
+}
+
+// build constructs a new instance of f without caching it.
+func (f *Provider[T]) build(c *Container, location string) (T, error) {
+	t, err := c.resolve(f, location, false)
 	if err != nil {
 		var zero T
 		return zero, err
@@ -57,7 +116,7 @@ func (f *Provider[T]) GetNew(c *Container) (T, error) {
 }
 
 func (f *Provider[T]) MustGetNew(c *Container) T {
-	t, err := f.GetNew(c)
+	t, err := f.getNew(c, getCallerLocation(2))
 	if err != nil {
 		panic(err)
 	}
@@ -73,17 +132,37 @@ func (f *Provider[T]) Set(c *Container, ins T) {
 	c.set(f, ins)
 }
 
+// Override replaces the factory of f for c and its scopes. Overrides must
+// be registered before the provider is resolved, typically with a fake in
+// tests; instances already held by c are left untouched. It panics when c
+// is a scope and f is not scoped, as the root container builds f.
+func (f *Provider[T]) Override(c *Container, new func(c *Container) (T, error)) {
+	if c.parent != nil && !f.isScoped() {
+		panic(fmt.Sprintf("ioc: cannot override %s on a scope, it is not scoped", f))
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.overrides[f] = func(c *Container) (any, error) {
+		return new(c)
+	}
+}
+
 func (f *Provider[T]) Refresh(c *Container) (ins T, err error) {
-	newIns, err := f.GetNew(c)
+	return f.refresh(c, getCallerLocation(2))
+}
+
+func (f *Provider[T]) refresh(c *Container, location string) (ins T, err error) {
+	c.meter().ProviderCall(f.String(), ProviderRefresh)
+	newIns, err := f.build(c, location)
 	if err != nil {
 		return newIns, err
 	}
-	f.Set(c, newIns)
+	c.home(f).set(f, newIns)
 	return newIns, nil
 }
 
 func (f *Provider[T]) MustRefresh(c *Container) T {
-	ins, err := f.Refresh(c)
+	ins, err := f.refresh(c, getCallerLocation(2))
 	if err != nil {
 		panic(err)
 	}
@@ -91,12 +170,33 @@ func (f *Provider[T]) MustRefresh(c *Container) T {
 }
 
 func NewProvider[T any](new func(c *Container) (T, error)) *Provider[T] {
-	return &Provider[T]{f: new}
+	return newProvider(new, getCallerLocation(2))
+}
+
+func newProvider[T any](new func(c *Container) (T, error), location string) *Provider[T] {
+	p := &Provider[T]{
+		f:    new,
+		name: uniqueProviderName(fmt.Sprintf("Provider[%s](%s)", reflect.TypeFor[T](), shortLocation(location))),
+	}
+	if new != nil {
+		register(p)
+	}
+	return p
+}
+
+// NewScopedProvider is like NewProvider, but the instance is held by the
+// container it is resolved from, so each scope gets its own instance.
+func NewScopedProvider[T any](new func(c *Container) (T, error)) *Provider[T] {
+	p := newProvider(new, getCallerLocation(2))
+	p.scoped = true
+	return p
 }
 
 type Providers[T any] struct {
-	ps map[string]*Provider[T]
-	mu sync.Mutex
+	ps     map[string]*Provider[T]
+	scoped bool
+	check  func(ins T) error
+	mu     sync.Mutex
 }
 
 func NewProviders[T any]() *Providers[T] {
@@ -105,13 +205,149 @@ func NewProviders[T any]() *Providers[T] {
 	}
 }
 
+// NewScopedProviders is like NewProviders, but every named provider is
+// created with NewScopedProvider semantics.
+func NewScopedProviders[T any]() *Providers[T] {
+	r := NewProviders[T]()
+	r.scoped = true
+	return r
+}
+
 func (r *Providers[T]) GetProvider(name string, new func(c *Container) (T, error)) *Provider[T] {
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	pvd := r.provider(name)
+	if pvd.f == nil {
+		pvd.f = r.checked(pvd, new)
+		register(pvd)
+	}
+	return pvd
+}
+
+// WithHealthCheck registers check as a health check of the instances held by
+// the providers of r, named after the provider.
+func (r *Providers[T]) WithHealthCheck(check func(ins T) error) *Providers[T] {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.check = check
+	return r
+}
+
+// checked wraps new to register the health check of r, once per container
+// holding instances of pvd. The check runs on the instance currently held,
+// so rebuilt instances replace the previous ones.
+func (r *Providers[T]) checked(pvd *Provider[T], new func(c *Container) (T, error)) func(c *Container) (T, error) {
+	return func(c *Container) (T, error) {
+		ins, err := new(c)
+		if err != nil {
+			return ins, err
+		}
+		r.mu.Lock()
+		check := r.check
+		r.mu.Unlock()
+		if check != nil {
+			home := c.home(pvd)
+			home.onHealthCheckOnce(pvd.String(), getCallerLocation(1), func() *healthy.Error {
+				ins, ok := home.get(pvd)
+				if !ok {
+					return nil
+				}
+				if err := check(ins.(T)); err != nil {
+					return &healthy.Error{Level: healthy.LError, Msg: err.Error()}
+				}
+				return nil
+			})
+		}
+		return ins, nil
+	}
+}
+
+// GetInstanceProvider returns the provider of instance declared by config
+// section, named InstanceName(section, instance). new typically decodes the
+// instance with Container.UnmarshalInstanceConfig.
+func (r *Providers[T]) GetInstanceProvider(section, instance string, new func(c *Container, instance string) (T, error)) *Provider[T] {
+	return r.GetProvider(InstanceName(section, instance), func(c *Container) (T, error) {
+		return new(c, instance)
+	})
+}
+
+// InstanceProviders returns the providers of the instances declared by
+// config section, sorted by instance name.
+func (r *Providers[T]) InstanceProviders(c *Container, section string, defaultContent []byte,
+	new func(c *Container, instance string) (T, error)) ([]*Provider[T], error) {
+	instances, err := c.ConfigInstances(section, defaultContent)
+	if err != nil {
+		return nil, err
+	}
+	pvds := make([]*Provider[T], len(instances))
+	for i, instance := range instances {
+		pvds[i] = r.GetInstanceProvider(section, instance, new)
+	}
+	return pvds, nil
+}
+
+// GetInstances resolves every instance declared by config section, keyed by
+// instance name. Instances failing to resolve are left out and their errors
+// are returned together.
+func (r *Providers[T]) GetInstances(c *Container, section string, defaultContent []byte,
+	new func(c *Container, instance string) (T, error)) (map[string]T, error) {
+	instances, err := c.ConfigInstances(section, defaultContent)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]T, len(instances))
+	var errs []error
+	for _, instance := range instances {
+		ins, err := r.GetInstanceProvider(section, instance, new).get(c, getCallerLocation(2))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		m[instance] = ins
+	}
+	if len(errs) > 0 {
+		return m, MultiError(errs)
+	}
+	return m, nil
+}
+
+// Override replaces the factory of the named provider for c, see
+// Provider.Override. The name does not need to be registered yet.
+func (r *Providers[T]) Override(c *Container, name string, new func(c *Container) (T, error)) {
+	r.mu.Lock()
+	pvd := r.provider(name)
+	r.mu.Unlock()
+	pvd.Override(c, new)
+}
+
+// provider returns the named provider, creating it without a factory if
+// needed. r.mu must be held.
+func (r *Providers[T]) provider(name string) *Provider[T] {
 	pvd := r.ps[name]
 	if pvd == nil {
-		pvd = NewProvider(new)
+		pvd = &Provider[T]{
+			name:   uniqueProviderName(fmt.Sprintf("Providers[%s](%q)", reflect.TypeFor[T](), name)),
+			scoped: r.scoped,
+		}
 		r.ps[name] = pvd
 	}
 	return pvd
 }
+
+// providerNames counts the providers created under each name.
+var providerNames = struct {
+	m  map[string]int
+	mu sync.Mutex
+}{m: map[string]int{}}
+
+// uniqueProviderName returns name, suffixed with #2, #3... when other
+// providers already have it.
+func uniqueProviderName(name string) string {
+	providerNames.mu.Lock()
+	defer providerNames.mu.Unlock()
+	providerNames.m[name]++
+	if n := providerNames.m[name]; n > 1 {
+		return fmt.Sprintf("%s#%d", name, n)
+	}
+	return name
+}
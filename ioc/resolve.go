@@ -0,0 +1,225 @@
+package ioc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrDependencyCycle = errors.New("ioc: dependency cycle")
+
+// ErrCaptiveDependency is returned when the factory of a provider held by
+// the root container resolves a scoped provider, whose instance it would
+// otherwise keep beyond its scope.
+var ErrCaptiveDependency = errors.New("ioc: singleton depends on scoped provider")
+
+// resolveFrame is one step of a resolution chain: provider p was requested
+// at location by the factory of parent (nil when requested from outside any
+// factory).
+type resolveFrame struct {
+	p        injector
+	location string
+	parent   *resolveFrame
+}
+
+func (f *resolveFrame) String() string {
+	return fmt.Sprintf("%s (requested at %s)", f.p, f.location)
+}
+
+// below returns the frames from f (exclusive) down to descendant d
+// (inclusive), or nil when d is not a descendant of f.
+func (f *resolveFrame) below(d *resolveFrame) []*resolveFrame {
+	var frames []*resolveFrame
+	for ; d != nil; d = d.parent {
+		if d == f {
+			for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+				frames[i], frames[j] = frames[j], frames[i]
+			}
+			return frames
+		}
+		frames = append(frames, d)
+	}
+	return nil
+}
+
+func cycleError(path []*resolveFrame) error {
+	parts := make([]string, len(path))
+	for i, f := range path {
+		parts[i] = f.String()
+	}
+	return fmt.Errorf("%w: %s", ErrDependencyCycle, strings.Join(parts, " -> "))
+}
+
+// resolve returns the instance of p, building it with p's factory unless
+// cached is set and the container or one of its ancestors already holds one.
+func (c *Container) resolve(p injector, location string, cached bool) (any, error) {
+	if err := c.checkOpen(); err != nil {
+		return nil, err
+	}
+	frame := &resolveFrame{p: p, location: location, parent: c.frame}
+	if c.frame != nil {
+		if p.isScoped() && !c.frame.p.isScoped() {
+			return nil, fmt.Errorf("%w: %s resolves %s", ErrCaptiveDependency, c.frame.p, frame)
+		}
+		// the edge belongs to the container holding the instance of the
+		// requesting provider
+		owner := c.home(c.frame.p)
+		owner.mu.Lock()
+		if owner.deps[c.frame.p] == nil {
+			owner.deps[c.frame.p] = map[injector]bool{}
+		}
+		owner.deps[c.frame.p][p] = true
+		owner.mu.Unlock()
+	}
+	if cached {
+		if ins, ok := c.get(p); ok {
+			return ins, nil
+		}
+	}
+
+	home := &Container{container: c.home(p), frame: c.frame}
+	lock, err := home.acquire(frame)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+
+	if cached {
+		if ins, ok := home.get(p); ok {
+			return ins, nil
+		}
+	}
+
+	home.mu.Lock()
+	home.building[p] = frame
+	home.mu.Unlock()
+	defer func() {
+		home.mu.Lock()
+		delete(home.building, p)
+		home.mu.Unlock()
+	}()
+
+	started := time.Now()
+	ins, err := home.build(p, &Container{container: home.container, frame: frame})
+	home.recordBuild(p, started, err)
+	home.meter().ProviderBuild(p.String(), time.Since(started), err)
+	if err != nil {
+		return nil, err
+	}
+	if cached {
+		if ins == nil {
+			return nil, fmt.Errorf("ioc: provider %s returned nil", p)
+		}
+		home.set(p, ins)
+	}
+	return ins, nil
+}
+
+// build constructs an instance of p, then passes it through the decorators
+// of p and the interceptors of the container.
+func (c *container) build(p injector, fc *Container) (any, error) {
+	ins, err := c.construct(p, fc)
+	if err != nil {
+		return nil, err
+	}
+	r := c.root()
+	r.mu.Lock()
+	interceptors := r.interceptors
+	r.mu.Unlock()
+	return p.decorate(fc, ins, interceptors)
+}
+
+// construct runs the override of p registered on c or its ancestors,
+// falling back to the factory of p when the resolve guard permits it.
+func (c *container) construct(p injector, fc *Container) (any, error) {
+	for o := c; o != nil; o = o.parent {
+		o.mu.Lock()
+		override, ok := o.overrides[p]
+		o.mu.Unlock()
+		if ok {
+			return override(fc)
+		}
+	}
+	r := c.root()
+	r.mu.Lock()
+	guard := r.guard
+	r.mu.Unlock()
+	if guard != nil {
+		if err := guard(p); err != nil {
+			return nil, err
+		}
+	}
+	return p.new(fc)
+}
+
+// acquire locks the per-container mutex of frame.p. It fails instead of
+// blocking when the request would close a dependency cycle, either within
+// the chain of frame itself or across chains resolved by other goroutines.
+func (c *Container) acquire(frame *resolveFrame) (*sync.Mutex, error) {
+	c.mu.Lock()
+	for f := frame.parent; f != nil; f = f.parent {
+		if f.p == frame.p {
+			c.mu.Unlock()
+			return nil, cycleError(append([]*resolveFrame{f}, f.below(frame)...))
+		}
+	}
+	if frame.parent != nil {
+		if path := c.deadlock(frame); path != nil {
+			c.mu.Unlock()
+			return nil, cycleError(path)
+		}
+		c.waiting[frame.parent] = frame
+	}
+	lock, ok := c.locks[frame.p]
+	if !ok {
+		lock = &sync.Mutex{}
+		c.locks[frame.p] = lock
+	}
+	c.mu.Unlock()
+
+	lock.Lock()
+
+	if frame.parent != nil {
+		c.mu.Lock()
+		delete(c.waiting, frame.parent)
+		c.mu.Unlock()
+	}
+	return lock, nil
+}
+
+// deadlock follows the wait-for graph starting at the chain currently
+// building frame.p. It returns the loop when that graph leads back to a
+// provider held by the chain of frame. c.mu must be held.
+func (c *Container) deadlock(frame *resolveFrame) []*resolveFrame {
+	held := map[injector]*resolveFrame{}
+	for f := frame.parent; f != nil; f = f.parent {
+		held[f.p] = f
+	}
+	visited := map[injector]bool{}
+	var path []*resolveFrame
+	for req := frame; ; {
+		b := c.building[req.p]
+		if b == nil || visited[req.p] {
+			return nil
+		}
+		visited[req.p] = true
+		var next *resolveFrame
+		for w, r := range c.waiting {
+			if frames := b.below(w); frames != nil || w == b {
+				path = append(path, frames...)
+				next = r
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		path = append(path, next)
+		if h, ok := held[next.p]; ok {
+			return append(append([]*resolveFrame{h}, h.below(frame)...), path...)
+		}
+		req = next
+	}
+}
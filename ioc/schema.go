@@ -0,0 +1,174 @@
+package ioc
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrUnknownConfigKeys = errors.New("ioc: unknown config keys")
+
+// RegisterConfigType records the struct config section is unmarshalled
+// into, for DefaultConfig.Schema. Packages call it from init next to
+// RegisterDefaultConfig.
+func RegisterConfigType(section string, cfg any) {
+	t := reflect.TypeOf(cfg)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	defaultConfigs.mu.Lock()
+	defer defaultConfigs.mu.Unlock()
+	defaultConfigs.types[section] = t
+}
+
+// Schema returns the JSON Schema of the section, accepting instances under
+// ConfigInstancesKey, or nil when no type is registered for it.
+func (d DefaultConfig) Schema() map[string]any {
+	if d.Type == nil {
+		return nil
+	}
+	s := JSONSchema(d.Type)
+	if props, ok := s["properties"].(map[string]any); ok {
+		props[ConfigInstancesKey] = map[string]any{
+			"type":                 "object",
+			"additionalProperties": JSONSchema(d.Type),
+		}
+	}
+	s["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	s["title"] = d.Section
+	return s
+}
+
+type configField struct {
+	name string
+	typ  reflect.Type
+}
+
+// configFields returns the fields of struct t keyed as mapstructure decodes
+// them, and whether a ",remain" field accepts any other key.
+func configFields(t reflect.Type) (fields []configField, open bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() && !f.Anonymous {
+			continue
+		}
+		tag := f.Tag.Get("mapstructure")
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+		if strings.Contains(opts, "remain") {
+			open = true
+			continue
+		}
+		ft := f.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if strings.Contains(opts, "squash") && ft.Kind() == reflect.Struct {
+			sub, subOpen := configFields(ft)
+			fields = append(fields, sub...)
+			open = open || subOpen
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, configField{name: strings.ToLower(name), typ: f.Type})
+	}
+	return fields, open
+}
+
+// unknownConfigKeys returns the keys of settings that t has no field for,
+// as dotted paths with list indexes.
+func unknownConfigKeys(t reflect.Type, settings any, prefix string) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var keys []string
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := settings.(map[string]any)
+		if !ok {
+			return nil
+		}
+		fields, open := configFields(t)
+		for k, v := range m {
+			i := slices.IndexFunc(fields, func(f configField) bool {
+				return f.name == strings.ToLower(k)
+			})
+			if i < 0 {
+				if !open {
+					keys = append(keys, joinKey(prefix, k))
+				}
+				continue
+			}
+			keys = append(keys, unknownConfigKeys(fields[i].typ, v, joinKey(prefix, k))...)
+		}
+	case reflect.Map:
+		if m, ok := settings.(map[string]any); ok {
+			for k, v := range m {
+				keys = append(keys, unknownConfigKeys(t.Elem(), v, joinKey(prefix, k))...)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if l, ok := settings.([]any); ok {
+			for i, v := range l {
+				keys = append(keys, unknownConfigKeys(t.Elem(), v, fmt.Sprintf("%s[%d]", prefix, i))...)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// JSONSchema returns the JSON Schema of the values mapstructure decodes into
+// a t. Structs reject unknown properties.
+func JSONSchema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == reflect.TypeFor[time.Duration]() {
+		return map[string]any{"type": []string{"string", "integer"}}
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		fields, open := configFields(t)
+		props := map[string]any{}
+		for _, f := range fields {
+			props[f.name] = JSONSchema(f.typ)
+		}
+		return map[string]any{
+			"type":                 "object",
+			"properties":           props,
+			"additionalProperties": open,
+		}
+	case reflect.Map:
+		return map[string]any{
+			"type":                 "object",
+			"additionalProperties": JSONSchema(t.Elem()),
+		}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string"}
+		}
+		return map[string]any{
+			"type":  "array",
+			"items": JSONSchema(t.Elem()),
+		}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	}
+	return map[string]any{}
+}
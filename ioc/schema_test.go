@@ -0,0 +1,83 @@
+package ioc
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type schemaServer struct {
+	Url string `mapstructure:"url"`
+}
+
+type schemaBase struct {
+	Name string `mapstructure:"name"`
+}
+
+type schemaConfig struct {
+	schemaBase `mapstructure:",squash"`
+	Port       int               `mapstructure:"port"`
+	Timeout    time.Duration     `mapstructure:"timeout"`
+	Servers    []schemaServer    `mapstructure:"servers"`
+	Levels     map[string]int64  `mapstructure:"levels"`
+	Extra      map[string]any    `mapstructure:",remain"`
+	Ignored    string            `mapstructure:"-"`
+	Tags       map[string]string `mapstructure:"tags"`
+}
+
+type schemaStrict struct {
+	Port    int            `mapstructure:"port"`
+	Servers []schemaServer `mapstructure:"servers"`
+}
+
+func TestJSONSchema(t *testing.T) {
+	s := JSONSchema(reflect.TypeFor[schemaConfig]())
+	assert.Equal(t, "object", s["type"])
+	assert.Equal(t, true, s["additionalProperties"])
+	props := s["properties"].(map[string]any)
+	assert.Len(t, props, 6)
+	assert.Equal(t, map[string]any{"type": "string"}, props["name"])
+	assert.Equal(t, map[string]any{"type": "integer"}, props["port"])
+	assert.Equal(t, map[string]any{"type": []string{"string", "integer"}}, props["timeout"])
+	assert.Equal(t, map[string]any{
+		"type":                 "object",
+		"additionalProperties": map[string]any{"type": "integer"},
+	}, props["levels"])
+	assert.Equal(t, map[string]any{
+		"type": "array",
+		"items": map[string]any{
+			"type":                 "object",
+			"properties":           map[string]any{"url": map[string]any{"type": "string"}},
+			"additionalProperties": false,
+		},
+	}, props["servers"])
+}
+
+func TestVipers_UnmarshalUnknownKeys(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "server.yaml")
+	overlay := filepath.Join(dir, "server.test.yaml")
+	assert.NoError(t, os.WriteFile(base, []byte("port: 80\nprot: 81\n"), 0644))
+	assert.NoError(t, os.WriteFile(overlay, []byte("servers:\n  - url: a\n  - urll: b\n"), 0644))
+
+	vipers, err := NewVipers(dir, ConfigEnvTest)
+	assert.NoError(t, err)
+
+	var cfg schemaStrict
+	err = vipers.Unmarshal("server", &cfg, nil)
+	assert.ErrorIs(t, err, ErrUnknownConfigKeys)
+	assert.ErrorContains(t, err, `"prot" in `+base)
+	assert.ErrorContains(t, err, `"servers[1].urll" in `+overlay)
+
+	// unknown keys are accepted by ",remain" fields and maps
+	var open schemaConfig
+	err = vipers.Unmarshal("server", &open, nil)
+	assert.ErrorContains(t, err, "servers[1].urll")
+	assert.NotContains(t, err.Error(), "prot")
+	var m map[string]any
+	assert.NoError(t, vipers.Unmarshal("server", &m, nil))
+}
@@ -0,0 +1,151 @@
+package ioc
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const redacted = "******"
+
+var envRefPattern = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// resolveRefs resolves the references in the string values of settings and
+// returns the dotted keys of the values read from a file or decoded, which
+// are secret:
+//
+//	${VAR}, ${VAR:-default}  interpolated from the environment, $${ escapes
+//	file:///run/secrets/x    replaced by the content of the file
+//	base64:c2VjcmV0          replaced by the decoded data
+func resolveRefs(settings map[string]any) ([]string, error) {
+	var keys []string
+	var walk func(prefix string, v any) (any, error)
+	walk = func(prefix string, v any) (any, error) {
+		switch val := v.(type) {
+		case map[string]any:
+			for k, sub := range val {
+				r, err := walk(joinKey(prefix, k), sub)
+				if err != nil {
+					return nil, err
+				}
+				val[k] = r
+			}
+		case []any:
+			l := make([]any, len(val))
+			for i, sub := range val {
+				r, err := walk(fmt.Sprintf("%s[%d]", prefix, i), sub)
+				if err != nil {
+					return nil, err
+				}
+				l[i] = r
+			}
+			return l, nil
+		case string:
+			r, ok, err := resolveRef(val)
+			if err != nil {
+				return nil, fmt.Errorf("resolving \"%s\": %w", prefix, err)
+			}
+			if ok {
+				keys = append(keys, prefix)
+			}
+			return r, nil
+		}
+		return v, nil
+	}
+	_, err := walk("", settings)
+	return keys, err
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// resolveRef resolves the references in s and reports whether the result
+// is secret. Environment variables are only interpolated, so they are not.
+func resolveRef(s string) (string, bool, error) {
+	var err error
+	s = envRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		if strings.HasPrefix(ref, "$$") {
+			return ref[1:]
+		}
+		m := envRefPattern.FindStringSubmatch(ref)
+		if v, ok := os.LookupEnv(m[1]); ok {
+			return v
+		}
+		if strings.Contains(ref, ":-") {
+			return m[2]
+		}
+		err = fmt.Errorf("environment variable %s is not set", m[1])
+		return ref
+	})
+	if err != nil {
+		return "", false, err
+	}
+	switch {
+	case strings.HasPrefix(s, "file://"):
+		data, err := os.ReadFile(strings.TrimPrefix(s, "file://"))
+		if err != nil {
+			return "", false, err
+		}
+		return strings.TrimRight(string(data), "\r\n"), true, nil
+	case strings.HasPrefix(s, "base64:"):
+		data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(s, "base64:"))
+		if err != nil {
+			return "", false, err
+		}
+		return string(data), true, nil
+	}
+	return s, false, nil
+}
+
+// isSecretKey reports whether the last element of a dotted key names a
+// credential, in which case its value is redacted even if it is written in
+// plain text.
+func isSecretKey(key string) bool {
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		key = key[i+1:]
+	}
+	key = strings.ToLower(key)
+	for _, s := range []string{"password", "secret", "token", "credential"} {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// redact returns a copy of settings where the values of secretKeys and of
+// keys naming credentials are replaced.
+func redact(settings map[string]any, secretKeys []string) map[string]any {
+	secrets := map[string]bool{}
+	for _, k := range secretKeys {
+		secrets[k] = true
+	}
+	var walk func(prefix string, v any) any
+	walk = func(prefix string, v any) any {
+		switch val := v.(type) {
+		case map[string]any:
+			m := make(map[string]any, len(val))
+			for k, sub := range val {
+				m[k] = walk(joinKey(prefix, k), sub)
+			}
+			return m
+		case []any:
+			l := make([]any, len(val))
+			for i, sub := range val {
+				l[i] = walk(fmt.Sprintf("%s[%d]", prefix, i), sub)
+			}
+			return l
+		}
+		if secrets[prefix] || isSecretKey(prefix) {
+			return redacted
+		}
+		return v
+	}
+	return walk("", settings).(map[string]any)
+}
@@ -0,0 +1,73 @@
+package ioc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVipers_SecretRefs(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "db-password")
+	assert.NoError(t, os.WriteFile(secretFile, []byte("s3cret\n"), 0600))
+	t.Setenv("SECRETS_TEST_HOST", "db.internal")
+
+	content := `
+host: ${SECRETS_TEST_HOST}
+port: ${SECRETS_TEST_PORT:-5432}
+dsn: postgres://${SECRETS_TEST_HOST}/app
+password: file://` + secretFile + `
+token: base64:dG9rZW4=
+literal: $${NOT_A_VAR}
+`
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "db.test.yaml"), []byte(content), 0644))
+
+	vipers, err := NewVipers(dir, ConfigEnvTest)
+	assert.NoError(t, err)
+
+	var cfg struct {
+		Host     string `mapstructure:"host"`
+		Port     int    `mapstructure:"port"`
+		DSN      string `mapstructure:"dsn"`
+		Password string `mapstructure:"password"`
+		Token    string `mapstructure:"token"`
+		Literal  string `mapstructure:"literal"`
+	}
+	assert.NoError(t, vipers.Unmarshal("db", &cfg, nil))
+	assert.Equal(t, "db.internal", cfg.Host)
+	assert.Equal(t, 5432, cfg.Port)
+	assert.Equal(t, "postgres://db.internal/app", cfg.DSN)
+	assert.Equal(t, "s3cret", cfg.Password)
+	assert.Equal(t, "token", cfg.Token)
+	assert.Equal(t, "${NOT_A_VAR}", cfg.Literal)
+
+	redacted, err := vipers.Redacted("db")
+	assert.NoError(t, err)
+	assert.Equal(t, redacted["host"], "db.internal")
+	assert.Equal(t, redacted["dsn"], "postgres://db.internal/app")
+	assert.Equal(t, redacted["password"], "******")
+	assert.Equal(t, redacted["token"], "******")
+	assert.Equal(t, redacted["literal"], "${NOT_A_VAR}")
+}
+
+func TestVipers_SecretRefsErrors(t *testing.T) {
+	_, err := NewVipersFromMap(map[string]map[string]any{
+		"db": {"password": "${SECRETS_TEST_UNSET}"},
+	})
+	assert.ErrorContains(t, err, "SECRETS_TEST_UNSET is not set")
+
+	_, err = NewVipersFromMap(map[string]map[string]any{
+		"db": {"auth": map[string]any{"password": "file:///nonexistent/secret"}},
+	})
+	assert.ErrorContains(t, err, `resolving "auth.password"`)
+
+	vipers, err := NewVipersFromMap(map[string]map[string]any{
+		"db": {"user": "app", "password": "plain"},
+	})
+	assert.NoError(t, err)
+	redacted, err := vipers.Redacted("db")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"user": "app", "password": "******"}, redacted)
+}
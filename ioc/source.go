@@ -0,0 +1,186 @@
+package ioc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/spf13/viper"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ConfigSource provides config sections from outside the config dir, such
+// as an HTTP endpoint, a key-value store or a SQL table.
+type ConfigSource interface {
+	// String names the source in errors and logs.
+	String() string
+	// Load returns the settings of every section the source holds. It may
+	// block until they change, for sources supporting long polling.
+	Load(ctx context.Context) (map[string]map[string]any, error)
+}
+
+type sourceState struct {
+	src      ConfigSource
+	sections map[string]map[string]any
+}
+
+// DecodeConfig decodes a JSON, YAML or TOML document, for sources holding
+// sections as text.
+func DecodeConfig(data []byte) (map[string]any, error) {
+	ct := contentType(data)
+	if ct == "" {
+		return nil, fmt.Errorf("cannot determine the format of the config data")
+	}
+	v := viper.New()
+	v.SetConfigType(ct)
+	err := v.ReadConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return v.AllSettings(), nil
+}
+
+// AddSource loads the sections of src as layers on top of the config files
+// and of the sources added before, then polls src every interval and reloads
+// the sections it changes, calling their subscribers. A zero interval suits
+// sources whose Load blocks until a change.
+func (c *Vipers) AddSource(ctx context.Context, src ConfigSource, interval time.Duration) error {
+	sections, err := src.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("error loading config source %s: %w", src, err)
+	}
+	s := &sourceState{src: src}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return fmt.Errorf("config is closed")
+	}
+	if c.stop == nil {
+		c.polling, c.stop = context.WithCancel(context.Background())
+	}
+	c.sources = append(c.sources, s)
+	polling := c.polling
+	c.mu.Unlock()
+
+	if err = c.applySource(s, sections); err != nil {
+		c.mu.Lock()
+		c.sources = slices.DeleteFunc(c.sources, func(o *sourceState) bool {
+			return o == s
+		})
+		c.mu.Unlock()
+		return fmt.Errorf("error loading config source %s: %w", src, err)
+	}
+	go c.poll(polling, s, max(interval, minSourceDelay), maxSourceBackoff)
+	return nil
+}
+
+var (
+	// minSourceDelay is the least time between two loads of a source, so a
+	// zero interval with a source not blocking until a change does not spin.
+	minSourceDelay = time.Second
+	// maxSourceBackoff bounds the delay between loads of a failing source,
+	// doubled after each failure.
+	maxSourceBackoff = time.Minute
+)
+
+// poll loads s every interval, backing off up to maxBackoff while it fails.
+func (c *Vipers) poll(ctx context.Context, s *sourceState, interval, maxBackoff time.Duration) {
+	delay := interval
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		sections, err := s.src.Load(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			err = c.applySource(s, sections)
+		}
+		if err != nil {
+			delay = min(delay*2, max(maxBackoff, interval))
+			c.logger().Error("config source error", "source", s.src.String(), "error", err, "retry", delay)
+			continue
+		}
+		delay = interval
+	}
+}
+
+// applySource replaces the sections of s and reloads those that were or are
+// now part of it.
+func (c *Vipers) applySource(s *sourceState, sections map[string]map[string]any) error {
+	c.reloads.Lock()
+	defer c.reloads.Unlock()
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	var names []string
+	for name := range s.sections {
+		names = append(names, name)
+	}
+	for name := range sections {
+		if _, ok := s.sections[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	s.sections = sections
+	files := map[string][]string{}
+	for _, name := range names {
+		files[name] = c.files[name]
+	}
+	c.mu.Unlock()
+
+	slices.Sort(names)
+	var errs []error
+	for _, name := range names {
+		if err := c.reload(name, files[name]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return MultiError(errs)
+	}
+	return nil
+}
+
+// KVStore reads the values stored under a key prefix of a key-value store.
+type KVStore interface {
+	List(ctx context.Context, prefix string) (map[string][]byte, error)
+}
+
+type kvSource struct {
+	kv     KVStore
+	prefix string
+}
+
+// NewKVSource returns a source reading each section from the key
+// "<prefix><section>" of kv, holding a JSON, YAML or TOML document.
+func NewKVSource(kv KVStore, prefix string) ConfigSource {
+	return &kvSource{kv: kv, prefix: prefix}
+}
+
+func (s *kvSource) String() string {
+	return fmt.Sprintf("kv:%s", s.prefix)
+}
+
+func (s *kvSource) Load(ctx context.Context) (map[string]map[string]any, error) {
+	values, err := s.kv.List(ctx, s.prefix)
+	if err != nil {
+		return nil, err
+	}
+	sections := map[string]map[string]any{}
+	for key, data := range values {
+		settings, err := DecodeConfig(data)
+		if err != nil {
+			return nil, fmt.Errorf("key \"%s\": %w", key, err)
+		}
+		sections[strings.TrimPrefix(key, s.prefix)] = settings
+	}
+	return sections, nil
+}
@@ -0,0 +1,182 @@
+package ioc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// fastSourcePolling lets the sources of a test be polled every few
+// milliseconds.
+func fastSourcePolling(t *testing.T) {
+	minDelay, maxBackoff := minSourceDelay, maxSourceBackoff
+	minSourceDelay, maxSourceBackoff = 10*time.Millisecond, 40*time.Millisecond
+	t.Cleanup(func() {
+		minSourceDelay, maxSourceBackoff = minDelay, maxBackoff
+	})
+}
+
+type failingSource struct {
+	loads atomic.Int32
+}
+
+func (s *failingSource) Load(ctx context.Context) (map[string]map[string]any, error) {
+	if s.loads.Add(1) == 1 {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("connection refused")
+}
+
+func (s *failingSource) String() string {
+	return "failing"
+}
+
+func TestSourceBackoff(t *testing.T) {
+	fastSourcePolling(t)
+	vipers, err := NewVipersFromMap(nil)
+	assert.NoError(t, err)
+	defer vipers.Close()
+
+	// a zero interval neither spins nor floods the log when loads fail
+	src := &failingSource{}
+	assert.NoError(t, vipers.AddSource(context.Background(), src, 0))
+	time.Sleep(300 * time.Millisecond)
+	loads := src.loads.Load()
+	assert.GreaterOrEqual(t, loads, int32(3))
+	assert.LessOrEqual(t, loads, int32(12))
+}
+
+func TestHTTPSource(t *testing.T) {
+	fastSourcePolling(t)
+	var mu sync.Mutex
+	version, body := 1, `{"server": {"port": 8080}}`
+	var notModified atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		etag := fmt.Sprintf(`"%d"`, version)
+		if r.Header.Get("If-None-Match") == etag {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "server.test.yaml"), []byte("host: localhost\nport: 80\n"), 0644)
+	assert.NoError(t, err)
+	c := NewContainer()
+	defer c.Close()
+	assert.NoError(t, c.LoadConfig(dir, ConfigEnvTest))
+	assert.NoError(t, c.AddConfigSource(context.Background(), NewHTTPSource(srv.URL), 20*time.Millisecond))
+
+	var cfg struct {
+		Host string `mapstructure:"host"`
+		Port int    `mapstructure:"port"`
+	}
+	assert.NoError(t, c.UnmarshalConfig("server", &cfg, nil))
+	assert.Equal(t, "localhost", cfg.Host)
+	assert.Equal(t, 8080, cfg.Port)
+
+	ports := make(chan int, 4)
+	assert.NoError(t, c.WatchConfig("server", func(v *viper.Viper) {
+		ports <- v.GetInt("port")
+	}))
+
+	// unchanged content is not reloaded
+	assert.Eventually(t, func() bool {
+		return notModified.Load() > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	version, body = 2, `{"server": {"port": 9090}}`
+	mu.Unlock()
+	assert.Equal(t, 9090, waitFor(t, ports))
+
+	// nothing is polled once closed
+	assert.NoError(t, c.Close())
+	mu.Lock()
+	version, body = 3, `{"server": {"port": 7070}}`
+	mu.Unlock()
+	select {
+	case port := <-ports:
+		t.Errorf("reloaded port %d once closed", port)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+type mapKV struct {
+	values map[string][]byte
+	mu     sync.Mutex
+}
+
+func (m *mapKV) List(_ context.Context, prefix string) (map[string][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	values := map[string][]byte{}
+	for k, v := range m.values {
+		if len(k) >= len(prefix) && k[:len(prefix)] == prefix {
+			values[k] = v
+		}
+	}
+	return values, nil
+}
+
+func (m *mapKV) set(key, value string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[key] = []byte(value)
+}
+
+func TestKVSource(t *testing.T) {
+	fastSourcePolling(t)
+	kv := &mapKV{values: map[string][]byte{
+		"config:server": []byte("port: 8080\n"),
+		"other:server":  []byte("port: 1\n"),
+	}}
+	vipers, err := NewVipersFromMap(map[string]map[string]any{
+		"server": {"host": "localhost"},
+	})
+	assert.NoError(t, err)
+	defer vipers.Close()
+	assert.NoError(t, vipers.AddSource(context.Background(), NewKVSource(kv, "config:"), 20*time.Millisecond))
+
+	vp, err := vipers.GetOrCreateViper("server", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "localhost", vp.GetString("host"))
+	assert.Equal(t, 8080, vp.GetInt("port"))
+
+	// sections may come from sources only
+	changed := make(chan *viper.Viper, 1)
+	kv.set("config:queue", `{"size": 10}`)
+	assert.Eventually(t, func() bool {
+		return vipers.WatchConfig("queue", func(v *viper.Viper) {
+			changed <- v
+		}) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	kv.set("config:queue", `{"size": 20}`)
+	select {
+	case v := <-changed:
+		assert.Equal(t, 20, v.GetInt("size"))
+	case <-time.After(time.Second):
+		t.Fatal("queue section not reloaded")
+	}
+
+	// unknown keys name the source
+	var cfg struct {
+		Host string `mapstructure:"host"`
+	}
+	assert.ErrorContains(t, vipers.Unmarshal("server", &cfg, nil), `"port" in kv:config:`)
+}
@@ -0,0 +1,52 @@
+package ioc
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrContainerClosed is returned when resolving a provider from a container,
+// or a scope of a container, that is closing or closed.
+var ErrContainerClosed = errors.New("ioc: container is closed")
+
+type ContainerState int
+
+const (
+	StateRunning ContainerState = iota
+	StateClosing
+	StateClosed
+)
+
+func (s ContainerState) String() string {
+	switch s {
+	case StateRunning:
+		return "running"
+	case StateClosing:
+		return "closing"
+	case StateClosed:
+		return "closed"
+	}
+	return fmt.Sprintf("ContainerState(%d)", int(s))
+}
+
+// State returns the state of c. A scope reports its own state, which stays
+// running when only its parent is closed.
+func (c *Container) State() ContainerState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// checkOpen fails with ErrContainerClosed when c or one of its ancestors is
+// closing or closed.
+func (c *container) checkOpen() error {
+	for ; c != nil; c = c.parent {
+		c.mu.Lock()
+		state := c.state
+		c.mu.Unlock()
+		if state != StateRunning {
+			return fmt.Errorf("%w (%s)", ErrContainerClosed, state)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package ioc
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type closable struct {
+	closed int
+}
+
+func TestContainer_CloseState(t *testing.T) {
+	p := NewProvider(func(c *Container) (*closable, error) {
+		ins := &closable{}
+		c.OnClose(func() error {
+			ins.closed++
+			return errors.New("close failed")
+		})
+		return ins, nil
+	})
+
+	c := NewContainer()
+	ins := p.MustGet(c)
+	assert.Equal(t, StateRunning, c.State())
+
+	var late []string
+	c.OnClose(func() error {
+		// registered during shutdown, runs immediately
+		c.OnClose(func() error {
+			late = append(late, "during")
+			return nil
+		})
+		assert.Equal(t, StateClosing, c.State())
+		return nil
+	})
+
+	err := c.Close()
+	assert.ErrorContains(t, err, "close failed")
+	assert.Equal(t, StateClosed, c.State())
+	assert.Equal(t, 1, ins.closed)
+	assert.Equal(t, []string{"during"}, late)
+
+	// closing again reports the first result without rerunning the closers
+	assert.Equal(t, err, c.Close())
+	assert.Equal(t, 1, ins.closed)
+
+	c.OnClose(func() error {
+		late = append(late, "after")
+		return nil
+	})
+	assert.Equal(t, []string{"during", "after"}, late)
+
+	_, err = p.Get(c)
+	assert.ErrorIs(t, err, ErrContainerClosed)
+	_, err = p.GetNew(c)
+	assert.ErrorIs(t, err, ErrContainerClosed)
+	_, err = p.Refresh(c)
+	assert.ErrorIs(t, err, ErrContainerClosed)
+	assert.ErrorIs(t, c.Run(context.Background()), ErrContainerClosed)
+}
+
+func TestContainer_CloseScope(t *testing.T) {
+	p := NewScopedProvider(func(c *Container) (*closable, error) {
+		return &closable{}, nil
+	})
+	c := NewContainer()
+	scope := c.NewScope()
+	p.MustGet(scope)
+
+	assert.NoError(t, scope.Close())
+	_, err := p.Get(scope)
+	assert.ErrorIs(t, err, ErrContainerClosed)
+	assert.Equal(t, StateRunning, c.State())
+	_, err = p.Get(c.NewScope())
+	assert.NoError(t, err)
+
+	// closing the parent closes the resolution of every scope
+	other := c.NewScope()
+	assert.NoError(t, c.Close())
+	_, err = p.Get(other)
+	assert.ErrorIs(t, err, ErrContainerClosed)
+}
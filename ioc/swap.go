@@ -0,0 +1,153 @@
+package ioc
+
+import (
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrKeepInstance is returned by the build function of WatchSwappable when
+// it applied a change to the current instance instead of building a new one.
+var ErrKeepInstance = errors.New("ioc: keep the current instance")
+
+// DefaultSwapGrace is how long a replaced instance stays open by default,
+// letting the calls that fetched it before the swap complete.
+var DefaultSwapGrace = 30 * time.Second
+
+// Swappable holds an instance that is rebuilt whenever its config section
+// changes. Consumers keep the Swappable and call Get for each use instead of
+// keeping the instance, so they pick up the new instance transparently.
+type Swappable[T any] struct {
+	cur     atomic.Pointer[swapped[T]]
+	logger  func() *slog.Logger
+	grace   time.Duration
+	retired map[*swapped[T]]*time.Timer
+	onSwap  []func(T)
+	closed  bool
+	mu      sync.Mutex
+}
+
+type swapped[T any] struct {
+	ins   T
+	close func() error
+}
+
+// Get returns the current instance.
+func (s *Swappable[T]) Get() T {
+	return s.cur.Load().ins
+}
+
+// OnSwap calls f with each instance swapped in from now on, once Get
+// returns it.
+func (s *Swappable[T]) OnSwap(f func(ins T)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onSwap = append(s.onSwap, f)
+}
+
+// WatchSwappable builds an instance from config section name with build,
+// writing defaultContent when the section does not exist. Like WatchTyped,
+// it then rebuilds the instance on each valid change of the section and
+// swaps it into the returned Swappable. The replaced instance is closed
+// after grace; every instance still open is closed with c.
+//
+// When build fails on a change, the current instance is kept and the error
+// is reported by the "config:<name>" health check. When build applied the
+// change to the current instance in place, it returns ErrKeepInstance and
+// nothing is swapped.
+func WatchSwappable[T, C any](c *Container, name string, defaultContent []byte, grace time.Duration,
+	build func(cfg *C) (T, func() error, error)) (*Swappable[T], error) {
+	s := &Swappable[T]{grace: grace, logger: c.logger, retired: map[*swapped[T]]*time.Timer{}}
+	err := WatchTyped(c, name, defaultContent, func(cfg *C) error {
+		ins, closer, err := build(cfg)
+		if errors.Is(err, ErrKeepInstance) && s.cur.Load() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return s.swap(&swapped[T]{ins: ins, close: closer})
+	})
+	if err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+	c.OnClose(s.Close)
+	return s, nil
+}
+
+func (s *Swappable[T]) swap(next *swapped[T]) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		closeSwapped(next)
+		return errors.New("swappable instance is closed")
+	}
+	prev := s.cur.Swap(next)
+	if prev != nil {
+		s.retire(prev)
+	}
+	onSwap := slices.Clone(s.onSwap)
+	s.mu.Unlock()
+	for _, f := range onSwap {
+		f(next.ins)
+	}
+	return nil
+}
+
+// retire closes prev once the grace period is over. s.mu must be held.
+func (s *Swappable[T]) retire(prev *swapped[T]) {
+	s.retired[prev] = time.AfterFunc(s.grace, func() {
+		s.mu.Lock()
+		_, ok := s.retired[prev]
+		delete(s.retired, prev)
+		s.mu.Unlock()
+		if ok {
+			if err := closeSwapped(prev); err != nil {
+				s.logger().Error("error closing replaced instance", "error", err)
+			}
+		}
+	})
+}
+
+// Close closes the current instance and the replaced ones still in their
+// grace period.
+func (s *Swappable[T]) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	open := []*swapped[T]{}
+	if cur := s.cur.Load(); cur != nil {
+		open = append(open, cur)
+	}
+	for prev, timer := range s.retired {
+		timer.Stop()
+		open = append(open, prev)
+	}
+	s.retired = nil
+	s.mu.Unlock()
+
+	var errs []error
+	for _, sw := range open {
+		if err := closeSwapped(sw); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return MultiError(errs)
+	}
+	return nil
+}
+
+func closeSwapped[T any](sw *swapped[T]) error {
+	if sw.close == nil {
+		return nil
+	}
+	return sw.close()
+}
@@ -0,0 +1,77 @@
+package ioc
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type swapClient struct {
+	port   int
+	closed bool
+}
+
+func TestWatchSwappable(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "client.test.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("port: 80\n"), 0644))
+
+	c := NewContainer()
+	assert.NoError(t, c.LoadConfig(dir, ConfigEnvTest))
+
+	var mu sync.Mutex
+	isClosed := func(cl *swapClient) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return cl.closed
+	}
+	closed := make(chan *swapClient, 4)
+	failed := make(chan int, 4)
+	s, err := WatchSwappable(c, "client", nil, 300*time.Millisecond, func(cfg *watchedConfig) (*swapClient, func() error, error) {
+		if cfg.Port == 666 {
+			failed <- cfg.Port
+			return nil, nil, fmt.Errorf("cannot connect")
+		}
+		cl := &swapClient{port: cfg.Port}
+		return cl, func() error {
+			mu.Lock()
+			cl.closed = true
+			mu.Unlock()
+			closed <- cl
+			return nil
+		}, nil
+	})
+	assert.NoError(t, err)
+	swapped := make(chan *swapClient, 1)
+	s.OnSwap(func(cl *swapClient) {
+		swapped <- cl
+	})
+	first := s.Get()
+	assert.Equal(t, 80, first.port)
+
+	// the old instance stays open during the grace period
+	assert.NoError(t, os.WriteFile(file, []byte("port: 81\n"), 0644))
+	second := waitFor(t, swapped)
+	assert.Same(t, second, s.Get())
+	assert.Equal(t, 81, second.port)
+	assert.False(t, isClosed(first))
+	assert.Same(t, first, waitFor(t, closed))
+
+	// a failing build keeps the current instance
+	assert.NoError(t, os.WriteFile(file, []byte("port: 666\n"), 0644))
+	waitFor(t, failed)
+	assert.Same(t, second, s.Get())
+
+	// closing the container closes the instances still open
+	assert.NoError(t, os.WriteFile(file, []byte("port: 82\n"), 0644))
+	third := waitFor(t, swapped)
+	assert.Equal(t, 82, third.port)
+	assert.NoError(t, c.Close())
+	assert.True(t, isClosed(second))
+	assert.True(t, isClosed(third))
+}
@@ -0,0 +1,105 @@
+package ioc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+var registry struct {
+	providers []injector
+	mu        sync.Mutex
+}
+
+// register records p so that Container.Validate can construct it.
+func register(p injector) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.providers = append(registry.providers, p)
+}
+
+func registered() []injector {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	return append([]injector(nil), registry.providers...)
+}
+
+// Validate eagerly constructs every provider created with NewProvider or
+// Providers.GetProvider so far, one after another, and returns the
+// aggregated errors. Scoped providers are constructed in a temporary scope.
+// Call it once the config is loaded and before serving requests.
+func (c *Container) Validate(ctx context.Context) error {
+	return c.ValidateParallel(ctx, 1)
+}
+
+// ValidateParallel is like Validate, but constructs up to workers providers
+// concurrently. Providers depending on each other still wait for their
+// dependencies to be constructed.
+func (c *Container) ValidateParallel(ctx context.Context, workers int) error {
+	location := getCallerLocation(2)
+	if workers < 1 {
+		workers = 1
+	}
+	scope := c.NewScope()
+	defer func() {
+		_ = scope.Close()
+	}()
+
+	var errs MultiError
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, workers)
+	for _, p := range registered() {
+		target := c
+		if p.isScoped() {
+			target = scope
+		}
+		select {
+		case <-ctx.Done():
+		case sem <- struct{}{}:
+		}
+		if err := ctx.Err(); err != nil {
+			mu.Lock()
+			errs = append(errs, fmt.Errorf("%s: %w", p, err))
+			mu.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func(p injector) {
+			defer wg.Done()
+			defer func() {
+				<-sem
+			}()
+			if err := target.validate(ctx, p, location); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", p, err))
+				mu.Unlock()
+			}
+		}(p)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (c *Container) validate(ctx context.Context, p injector, location string) error {
+	errChan := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errChan <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		_, err := c.resolve(p, location, true)
+		errChan <- err
+	}()
+	select {
+	case err := <-errChan:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -1,17 +1,24 @@
 package ioc
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"github.com/BurntSushi/toml"
-	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"gopkg.in/yaml.v3"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 var (
@@ -22,82 +29,420 @@ var (
 
 type ConfigEnv string
 
+var envFallbacks = struct {
+	m  map[ConfigEnv][]ConfigEnv
+	mu sync.Mutex
+}{m: map[ConfigEnv][]ConfigEnv{}}
+
+// NewConfigEnv declares an environment whose config falls back to the
+// given environments, in order, for keys its own files do not set:
+//
+//	var ConfigEnvStaging = ioc.NewConfigEnv("staging", ioc.ConfigEnvProd)
+func NewConfigEnv(name string, fallbacks ...ConfigEnv) ConfigEnv {
+	env := ConfigEnv(name)
+	envFallbacks.mu.Lock()
+	defer envFallbacks.mu.Unlock()
+	envFallbacks.m[env] = fallbacks
+	return env
+}
+
+// Chain returns env followed by its fallbacks, transitively and without
+// duplicates, highest priority first.
+func (e ConfigEnv) Chain() []ConfigEnv {
+	envFallbacks.mu.Lock()
+	defer envFallbacks.mu.Unlock()
+	var chain []ConfigEnv
+	var walk func(env ConfigEnv)
+	walk = func(env ConfigEnv) {
+		if slices.Contains(chain, env) {
+			return
+		}
+		chain = append(chain, env)
+		for _, f := range envFallbacks.m[env] {
+			walk(f)
+		}
+	}
+	walk(e)
+	return chain
+}
+
+// Vipers loads one viper per config section from a directory. A section is
+// made of layers deep-merged in order: the shared "<section>.<ext>" base
+// file, then the "<section>.<env>.<ext>" overlays of the environment chain,
+// the configured environment last, then the sections of the config sources
+// in the order they were added.
 type Vipers struct {
 	dir      string
 	env      ConfigEnv
+	chain    []ConfigEnv
+	static   map[string]map[string]any    // sections given to NewVipersFromMap
+	files    map[string][]string          // layer files per section, base first
+	secrets  map[string][]string          // keys resolved from references per section
+	sums     map[string]string            // digest of the layer contents per section
+	origins  map[string]map[string]string // layer file setting each key per section
 	encoders map[string]*viper.Viper
+	subs     map[string][]*subscriber
+	watcher  *configWatcher
+	sources  []*sourceState
+	polling  context.Context // done once the sources must stop polling
+	stop     context.CancelFunc
+	reloads  sync.Mutex // serializes reloads, and so the subscribers calls
+	audit    configAudit
+	log      atomic.Pointer[slog.Logger]
+	flags    *pflag.FlagSet // command-line flags overriding keys, see SetFlags
+	closed   bool
+	strict   bool
 	mu       sync.Mutex
 }
 
 func NewVipers(dir string, env ConfigEnv) (*Vipers, error) {
 
+	chain := env.Chain()
+	layers, err := scanConfigDir(dir, chain, unsupportedConfigFile)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Vipers{
+		dir:      dir,
+		env:      env,
+		chain:    chain,
+		files:    map[string][]string{},
+		secrets:  map[string][]string{},
+		sums:     map[string]string{},
+		origins:  map[string]map[string]string{},
+		encoders: map[string]*viper.Viper{},
+		subs:     map[string][]*subscriber{},
+	}
+	for subName, files := range layers {
+		c.files[subName] = files
+		vp, err := c.load(subName)
+		if err != nil {
+			return nil, err
+		}
+		c.encoders[subName] = vp
+	}
+	return c, nil
+}
+
+// NewVipersFromMap returns Vipers holding the given sections. It has no
+// directory, so default configs of missing sections are not written.
+func NewVipersFromMap(sections map[string]map[string]any) (*Vipers, error) {
+	c := &Vipers{
+		files:    map[string][]string{},
+		secrets:  map[string][]string{},
+		sums:     map[string]string{},
+		origins:  map[string]map[string]string{},
+		encoders: map[string]*viper.Viper{},
+		subs:     map[string][]*subscriber{},
+	}
+	c.static = sections
+	for name := range sections {
+		vp, err := c.load(name)
+		if err != nil {
+			return nil, err
+		}
+		c.encoders[name] = vp
+	}
+	return c, nil
+}
+
+func unsupportedConfigFile(file string) error {
+	return fmt.Errorf("unsupported config file type: %s", filepath.Ext(file))
+}
+
+// scanConfigDir returns the layer files of each section found in dir, base
+// first, for the environment chain. A file of the chain with an unsupported
+// type is passed to unsupported, which may return an error to abort the scan
+// or nil to skip it.
+func scanConfigDir(dir string, chain []ConfigEnv, unsupported func(file string) error) (map[string][]string, error) {
 	files, err := os.ReadDir(dir)
 	if err != nil {
 		return nil, err
 	}
 
-	encoders := make(map[string]*viper.Viper)
+	layers := map[string]map[int]string{}
 	for _, file := range files {
 		if file.IsDir() {
 			continue
 		}
 		filename := file.Name()
 		ext := filepath.Ext(filename)
-		suffix := fmt.Sprintf(".%s%s", env, ext)
-		if !strings.HasSuffix(filename, suffix) {
+		stem := strings.TrimSuffix(filename, ext)
+		subName, rank := stem, len(chain)
+		for i, e := range chain {
+			if strings.HasSuffix(stem, "."+string(e)) {
+				subName, rank = strings.TrimSuffix(stem, "."+string(e)), i
+				break
+			}
+		}
+		if rank == len(chain) && strings.Contains(stem, ".") {
+			// overlay of an environment outside the chain, or a hidden
+			// file such as the "..data" link of a Kubernetes volume
+			continue
+		}
+		if configType(ext) == "" {
+			if rank == 0 {
+				if err := unsupported(filename); err != nil {
+					return nil, err
+				}
+			}
 			continue
 		}
-		subName := strings.TrimSuffix(filename, suffix)
-		if encoders[subName] != nil {
-			return nil, fmt.Errorf("duplicate config file: \"%s\"", subName)
-		}
-		v := viper.New()
-		switch ext {
-		case ".json":
-			v.SetConfigType("json")
-		case ".yaml", ".yml":
-			v.SetConfigType("yaml")
-		case ".toml":
-			v.SetConfigType("toml")
-		default:
-			return nil, fmt.Errorf("unsupported config file type: %s", ext)
-		}
-		v.AutomaticEnv()
-		v.SetEnvPrefix(subName)
-		v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
-		v.SetConfigFile(filepath.Join(dir, filename))
-		err = v.ReadInConfig()
+		if layers[subName] == nil {
+			layers[subName] = map[int]string{}
+		}
+		if layers[subName][rank] != "" {
+			return nil, fmt.Errorf("duplicate config file: \"%s\"", stem)
+		}
+		layers[subName][rank] = filepath.Join(dir, filename)
+	}
+
+	sections := map[string][]string{}
+	for subName, ranks := range layers {
+		for rank := len(chain); rank >= 0; rank-- {
+			if f, ok := ranks[rank]; ok {
+				sections[subName] = append(sections[subName], f)
+			}
+		}
+	}
+	return sections, nil
+}
+
+func configType(ext string) string {
+	switch ext {
+	case ".json":
+		return "json"
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	}
+	return ""
+}
+
+// readLayerFile reads a layer file as is, without resolving the references
+// it contains.
+func readLayerFile(file string) (*viper.Viper, []byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading config file \"%s\": %w", filepath.Base(file), err)
+	}
+	v := viper.New()
+	v.SetConfigType(configType(filepath.Ext(file)))
+	err = v.ReadConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading config file \"%s\": %w", filepath.Base(file), err)
+	}
+	return v, data, nil
+}
+
+// load merges the layers of section name and resolves the references they
+// contain. c.mu must be held.
+func (c *Vipers) load(name string) (*viper.Viper, error) {
+	settings := map[string]any{}
+	origins := map[string]string{}
+	sum := sha256.New()
+	if section, ok := c.static[name]; ok {
+		mergeSettings(settings, section)
+	}
+	for _, file := range c.files[name] {
+		v, data, err := readLayerFile(file)
+		if err != nil {
+			return nil, err
+		}
+		mergeSettings(settings, v.AllSettings())
+		for _, k := range v.AllKeys() {
+			origins[k] = file
+		}
+		sum.Write([]byte(file))
+		sum.Write(data)
+	}
+	for _, src := range c.sources {
+		section, ok := src.sections[name]
+		if !ok {
+			continue
+		}
+		data, err := json.Marshal(section)
 		if err != nil {
-			return nil, fmt.Errorf("error reading config file \"%s\": %w", filename, err)
+			return nil, fmt.Errorf("error reading config \"%s\" from %s: %w", name, src.src, err)
 		}
-		encoders[subName] = v
+		mergeSettings(settings, section)
+		leaves := map[string]any{}
+		flattenSettings(section, "", leaves)
+		for k := range leaves {
+			origins[strings.ToLower(k)] = src.src.String()
+		}
+		sum.Write([]byte(src.src.String()))
+		sum.Write(data)
+	}
+	flagged := c.overrideSettings(name, settings, origins, sum)
+	c.sums[name] = hex.EncodeToString(sum.Sum(nil))
+	c.origins[name] = origins
+	secrets, err := resolveRefs(settings)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config \"%s\": %w", name, err)
+	}
+	c.secrets[name] = secrets
+	vp, err := newSectionViper(name, settings, flagged)
+	if err != nil {
+		return nil, fmt.Errorf("error merging config \"%s\": %w", name, err)
 	}
+	return vp, nil
+}
 
-	return &Vipers{
-		dir:      dir,
-		env:      env,
-		encoders: encoders,
-	}, nil
+// newSectionViper returns a viper holding settings, whose keys are also
+// read from the environment variables named by EnvVarName unless set by
+// flags.
+func newSectionViper(name string, settings, flagged map[string]any) (*viper.Viper, error) {
+	v := viper.New()
+	v.AutomaticEnv()
+	v.SetEnvPrefix(envPrefix(name))
+	v.SetEnvKeyReplacer(envNameReplacer)
+	err := v.MergeConfigMap(settings)
+	if err != nil {
+		return nil, err
+	}
+	for k, value := range flagged {
+		v.Set(k, value)
+	}
+	return v, nil
+}
+
+// mergeSettings deep-merges a copy of src into dst, values of src taking
+// precedence.
+func mergeSettings(dst, src map[string]any) {
+	for k, v := range src {
+		sm, ok := v.(map[string]any)
+		dm, dok := dst[k].(map[string]any)
+		if ok {
+			if !dok {
+				dm = map[string]any{}
+				dst[k] = dm
+			}
+			mergeSettings(dm, sm)
+			continue
+		}
+		dst[k] = v
+	}
 }
 
+// Unmarshal decodes section name into v, creating the section from def when
+// it does not exist. Keys v has no field for are rejected with
+// ErrUnknownConfigKeys.
 func (c *Vipers) Unmarshal(name string, v any, def []byte) error {
 	vp, err := c.GetOrCreateViper(name, def)
 	if err != nil {
 		return err
 	}
-	err = vp.Unmarshal(v)
+	return c.decode(name, vp, v)
+}
+
+func (c *Vipers) decode(name string, vp *viper.Viper, v any) error {
+	settings := vp.AllSettings()
+	delete(settings, ConfigInstancesKey)
+	if unknown := unknownConfigKeys(reflect.TypeOf(v), settings, ""); len(unknown) > 0 {
+		return c.unknownKeysError(name, unknown)
+	}
+	err := vp.Unmarshal(v)
 	if err != nil {
-		file := vp.ConfigFileUsed()
-		return fmt.Errorf("unmarshalling config \"%s\": %w", file, err)
+		return fmt.Errorf("unmarshalling config \"%s\": %w", c.describe(name), err)
 	}
 	return nil
 }
 
+// unknownKeysError wraps ErrUnknownConfigKeys with the keys of section name
+// and the layers setting them.
+func (c *Vipers) unknownKeysError(name string, unknown []string) error {
+	c.mu.Lock()
+	origins := c.origins[name]
+	c.mu.Unlock()
+	parts := make([]string, len(unknown))
+	for i, k := range unknown {
+		parts[i] = fmt.Sprintf("\"%s\"", k)
+		if file := keyOrigin(origins, k); file != "" {
+			parts[i] += fmt.Sprintf(" in %s", file)
+		}
+	}
+	return fmt.Errorf("config \"%s\": %w: %s", name, ErrUnknownConfigKeys, strings.Join(parts, ", "))
+}
+
+// keyOrigin returns the layer file setting key, or one of its parents.
+func keyOrigin(origins map[string]string, key string) string {
+	for {
+		if file, ok := origins[key]; ok {
+			return file
+		}
+		i := strings.LastIndexAny(key, ".[")
+		if i < 0 {
+			return ""
+		}
+		key = key[:i]
+	}
+}
+
+// Redacted returns the settings of section name with secrets masked, for
+// logging.
+func (c *Vipers) Redacted(name string) (map[string]any, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	vp, ok := c.encoders[name]
+	if !ok {
+		return nil, fmt.Errorf("config %s not found", name)
+	}
+	return redact(vp.AllSettings(), c.secrets[name]), nil
+}
+
+// describe returns the files section name is loaded from.
+func (c *Vipers) describe(name string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if files := c.files[name]; len(files) > 0 {
+		return strings.Join(files, ", ")
+	}
+	return name
+}
+
+// SetLogger sets the logger of the config watcher and sources, slog.Default
+// until set.
+func (c *Vipers) SetLogger(logger *slog.Logger) {
+	c.log.Store(logger)
+}
+
+func (c *Vipers) logger() *slog.Logger {
+	if logger := c.log.Load(); logger != nil {
+		return logger
+	}
+	return slog.Default()
+}
+
+// SetStrict makes GetOrCreateViper fail on missing sections instead of
+// writing their default content into the config dir.
+func (c *Vipers) SetStrict(strict bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.strict = strict
+}
+
+// has reports whether section name is loaded, without writing its default.
+func (c *Vipers) has(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.encoders[name]
+	return ok
+}
+
 func (c *Vipers) GetOrCreateViper(name string, defaultContent []byte) (*viper.Viper, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	vp, ok := c.encoders[name]
 	if !ok {
+		if c.dir == "" {
+			return nil, fmt.Errorf("config %s not found", name)
+		}
+		if c.strict {
+			return nil, fmt.Errorf("config %s not found in \"%s\" (strict mode)", name, c.dir)
+		}
 		ct := c.getContentType(defaultContent)
 		if ct == "" {
 			return nil, fmt.Errorf("cannot determine the format of the default data")
@@ -108,36 +453,17 @@ func (c *Vipers) GetOrCreateViper(name string, defaultContent []byte) (*viper.Vi
 		if err != nil {
 			return nil, fmt.Errorf("error writing default config file \"%s\": %w", filename, err)
 		}
-		log.Printf("default config file created: %s\n", filename)
-		vp = viper.New()
-		vp.AutomaticEnv()
-		vp.SetEnvPrefix(name)
-		vp.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
-		vp.SetConfigFile(filename)
-		err = vp.ReadInConfig()
+		c.logger().Info("default config file created", "file", filename)
+		c.files[name] = []string{filename}
+		vp, err = c.load(name)
 		if err != nil {
-			return nil, fmt.Errorf("error reading config file \"%s\": %w", filename, err)
+			return nil, err
 		}
 		c.encoders[name] = vp
 	}
 	return vp, nil
 }
 
-func (c *Vipers) WatchConfig(name string, callback func(v *viper.Viper)) error {
-	vp, ok := c.encoders[name]
-	if !ok {
-		return fmt.Errorf("config %s not found", name)
-	}
-
-	vp.WatchConfig()
-	vp.OnConfigChange(func(in fsnotify.Event) {
-		if in.Op&fsnotify.Write == fsnotify.Write {
-			callback(vp)
-		}
-	})
-	return nil
-}
-
 func (c *Vipers) UnmarshalAndWatch(name string, defaultContent []byte, callback func(v *viper.Viper)) error {
 	vp, err := c.GetOrCreateViper(name, defaultContent)
 	if err != nil {
@@ -148,6 +474,12 @@ func (c *Vipers) UnmarshalAndWatch(name string, defaultContent []byte, callback
 }
 
 func (c *Vipers) getContentType(content []byte) string {
+	return contentType(content)
+}
+
+// contentType returns the format of content: "json", "yaml" or "toml", or ""
+// when it is none of them.
+func contentType(content []byte) string {
 	dt := map[string]interface{}{}
 	err := json.Unmarshal(content, &dt)
 	if err == nil {
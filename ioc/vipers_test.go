@@ -152,3 +152,91 @@ func TestVipers_UnmarshalAndWatch(t *testing.T) {
 	time.Sleep(1 * time.Second)
 	assert.Equal(t, "new_value", result["key"])
 }
+
+func TestVipers_Layers(t *testing.T) {
+	dir := t.TempDir()
+	staging := NewConfigEnv("staging", ConfigEnvProd)
+
+	files := map[string]string{
+		"db.yaml": `
+host: localhost
+port: 5432
+pool:
+  max: 10
+  idle: 2
+`,
+		"db.prod.yaml": `
+host: db.prod
+pool:
+  max: 50
+`,
+		"db.staging.json": `{"pool": {"idle": 5}}`,
+		"db.dev.yaml":     `host: db.dev`,
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		assert.NoError(t, err)
+	}
+
+	type Pool struct {
+		Max  int `mapstructure:"max"`
+		Idle int `mapstructure:"idle"`
+	}
+	type DB struct {
+		Host string `mapstructure:"host"`
+		Port int    `mapstructure:"port"`
+		Pool Pool   `mapstructure:"pool"`
+	}
+
+	assert.Equal(t, []ConfigEnv{staging, ConfigEnvProd}, staging.Chain())
+
+	config, err := NewVipers(dir, staging)
+	assert.NoError(t, err)
+	var db DB
+	err = config.Unmarshal("db", &db, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, DB{Host: "db.prod", Port: 5432, Pool: Pool{Max: 50, Idle: 5}}, db)
+
+	config, err = NewVipers(dir, ConfigEnvTest)
+	assert.NoError(t, err)
+	db = DB{}
+	err = config.Unmarshal("db", &db, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, DB{Host: "localhost", Port: 5432, Pool: Pool{Max: 10, Idle: 2}}, db)
+}
+
+func TestVipers_WatchBaseLayer(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"key": "base", "other": "base"}`), 0644)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "config.test.json"), []byte(`{"key": "value"}`), 0644)
+	assert.NoError(t, err)
+
+	config, err := NewVipers(dir, ConfigEnvTest)
+	assert.NoError(t, err)
+
+	results := make(chan map[string]string, 4)
+	err = config.UnmarshalAndWatch("config", nil, func(v *viper.Viper) {
+		var result map[string]string
+		_ = v.Unmarshal(&result)
+		results <- result
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"key": "value", "other": "base"}, waitFor(t, results))
+
+	err = os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"key": "base", "other": "new"}`), 0644)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"key": "value", "other": "new"}, waitFor(t, results))
+}
+
+// waitFor returns the next value sent on ch, failing t when none comes.
+func waitFor[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
+		panic("unreachable")
+	}
+}
@@ -0,0 +1,127 @@
+package ioc
+
+import (
+	"fmt"
+	"github.com/aiechoic/services/ioc/healthy"
+	"github.com/spf13/viper"
+	"sync"
+	"time"
+)
+
+// configDebounce is how long a watched section must stay unchanged before
+// its new content is applied, so that bursts of file events apply once.
+var configDebounce = 200 * time.Millisecond
+
+// ConfigValidator is implemented by config structs that check their own
+// content after unmarshalling.
+type ConfigValidator interface {
+	Validate() error
+}
+
+// WatchTyped unmarshals config section name into a T, writing defaultContent
+// when the section does not exist, and passes it to handler. It then watches
+// the section and calls handler again with each valid new content.
+//
+// Content is valid when it unmarshals, when *T's Validate method (if any)
+// returns nil and when handler itself returns nil. The first content must be
+// valid, otherwise its error is returned. Later invalid content is skipped,
+// leaving the previously applied config in place, and is reported by a
+// health check named "config:<name>" until a valid content is applied.
+func WatchTyped[T any](c *Container, name string, defaultContent []byte, handler func(cfg *T) error) error {
+	c.recordConfig(name)
+	vipers, err := c.config()
+	if err != nil {
+		return err
+	}
+	vp, err := vipers.GetOrCreateViper(name, defaultContent)
+	if err != nil {
+		return err
+	}
+	w := &typedWatch[T]{vipers: vipers, name: name, handler: handler}
+	if err = w.apply(vp); err != nil {
+		return err
+	}
+	c.onHealthCheck("config:"+name, getCallerLocation(2), w.check)
+	c.OnClose(w.stop)
+	return vipers.WatchConfig(name, w.schedule)
+}
+
+type typedWatch[T any] struct {
+	vipers  *Vipers
+	name    string
+	handler func(cfg *T) error
+	pending *viper.Viper
+	timer   *time.Timer
+	stopped bool
+	lastErr error
+	mu      sync.Mutex
+}
+
+func (w *typedWatch[T]) apply(vp *viper.Viper) error {
+	cfg := new(T)
+	err := w.vipers.decode(w.name, vp, cfg)
+	if err != nil {
+		return err
+	}
+	if v, ok := any(cfg).(ConfigValidator); ok {
+		if err = v.Validate(); err != nil {
+			return fmt.Errorf("invalid config \"%s\": %w", w.vipers.describe(w.name), err)
+		}
+	}
+	if err = w.handler(cfg); err != nil {
+		return fmt.Errorf("applying config \"%s\": %w", w.vipers.describe(w.name), err)
+	}
+	return nil
+}
+
+// schedule applies vp once no newer content arrived for configDebounce.
+func (w *typedWatch[T]) schedule(vp *viper.Viper) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopped {
+		return
+	}
+	w.pending = vp
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.timer = time.AfterFunc(configDebounce, w.flush)
+}
+
+func (w *typedWatch[T]) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	vp := w.pending
+	if w.stopped || vp == nil {
+		return
+	}
+	w.pending = nil
+	w.lastErr = w.apply(vp)
+	if w.lastErr != nil {
+		w.vipers.logger().Error("config not applied, keeping the previous config", "section", w.name, "error", w.lastErr)
+	} else {
+		w.vipers.logger().Info("config reloaded", "section", w.name)
+	}
+}
+
+func (w *typedWatch[T]) check() *healthy.Error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.lastErr != nil {
+		return &healthy.Error{
+			Level: healthy.LError,
+			Msg:   w.lastErr.Error(),
+		}
+	}
+	return nil
+}
+
+func (w *typedWatch[T]) stop() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopped = true
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	return nil
+}
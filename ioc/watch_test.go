@@ -0,0 +1,73 @@
+package ioc
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type watchedConfig struct {
+	Port int `mapstructure:"port"`
+}
+
+func (c *watchedConfig) Validate() error {
+	if c.Port <= 0 {
+		return fmt.Errorf("port must be positive")
+	}
+	return nil
+}
+
+func TestWatchTyped(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "server.test.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("port: 80\n"), 0644))
+
+	c := NewContainer()
+	defer c.Close()
+	assert.NoError(t, c.LoadConfig(dir, ConfigEnvTest))
+
+	applied := make(chan int, 4)
+	err := WatchTyped(c, "server", nil, func(cfg *watchedConfig) error {
+		applied <- cfg.Port
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 80, waitFor(t, applied))
+
+	// invalid content keeps the previous config and fails the health check
+	assert.NoError(t, os.WriteFile(file, []byte("port: -1\n"), 0644))
+	assert.Eventually(t, func() bool {
+		return len(c.CheckHealth(context.Background())) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Empty(t, applied)
+	errs := c.CheckHealth(context.Background())
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "config:server", errs[0].Component)
+		assert.Contains(t, errs[0].Msg, "port must be positive")
+	}
+
+	// a burst of writes is applied once
+	for i := 1; i <= 3; i++ {
+		assert.NoError(t, os.WriteFile(file, []byte(fmt.Sprintf("port: 808%d\n", i)), 0644))
+	}
+	assert.Equal(t, 8083, waitFor(t, applied))
+	assert.Empty(t, c.CheckHealth(context.Background()))
+}
+
+func TestWatchTyped_InvalidInitialConfig(t *testing.T) {
+	c := NewContainer()
+	defer c.Close()
+	assert.NoError(t, c.LoadConfigMap(map[string]map[string]any{
+		"server": {"port": 0},
+	}))
+	err := WatchTyped(c, "server", nil, func(cfg *watchedConfig) error {
+		t.Error("handler called with an invalid config")
+		return nil
+	})
+	assert.ErrorContains(t, err, "port must be positive")
+}
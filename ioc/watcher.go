@@ -0,0 +1,205 @@
+package ioc
+
+import (
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// watchDebounce delays the rescan of the config dir after a file event, so
+// that the events of one save, or of one Kubernetes ConfigMap update, are
+// handled once.
+var watchDebounce = 100 * time.Millisecond
+
+type subscriber struct {
+	callback func(v *viper.Viper)
+}
+
+// configWatcher rescans the config dir after any event in it. Comparing the
+// layer files and their content instead of reacting to single events covers
+// plain writes, editors saving through a rename, files removed and created
+// again, and the "..data" symlink swap of Kubernetes volumes alike.
+type configWatcher struct {
+	fs     *fsnotify.Watcher
+	timer  *time.Timer
+	closed bool
+	mu     sync.Mutex
+}
+
+// WatchConfig calls callback with the reloaded section each time the
+// content of its layer files changes.
+func (c *Vipers) WatchConfig(name string, callback func(v *viper.Viper)) error {
+	_, err := c.Subscribe(name, callback)
+	return err
+}
+
+// Subscribe is like WatchConfig and also returns a function that removes
+// the subscription. Subscribers of a section are called one at a time, in
+// the order they subscribed.
+func (c *Vipers) Subscribe(name string, callback func(v *viper.Viper)) (unsubscribe func(), err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.encoders[name]; !ok {
+		return nil, fmt.Errorf("config %s not found", name)
+	}
+	if c.dir != "" && c.watcher == nil && !c.closed {
+		fs, err := fsnotify.NewWatcher()
+		if err != nil {
+			return nil, fmt.Errorf("error watching config dir \"%s\": %w", c.dir, err)
+		}
+		err = fs.Add(c.dir)
+		if err != nil {
+			_ = fs.Close()
+			return nil, fmt.Errorf("error watching config dir \"%s\": %w", c.dir, err)
+		}
+		c.watcher = &configWatcher{fs: fs}
+		go c.watch(c.watcher)
+	}
+	s := &subscriber{callback: callback}
+	c.subs[name] = append(c.subs[name], s)
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.subs[name] = slices.DeleteFunc(c.subs[name], func(o *subscriber) bool {
+			return o == s
+		})
+	}, nil
+}
+
+// Close stops watching the config dir and polling the config sources.
+// Subscribers are not called anymore once it returns.
+func (c *Vipers) Close() error {
+	c.mu.Lock()
+	w, stop := c.watcher, c.stop
+	c.watcher, c.stop = nil, nil
+	c.closed = true
+	c.mu.Unlock()
+	if stop != nil {
+		stop()
+	}
+	var err error
+	if w != nil {
+		w.mu.Lock()
+		w.closed = true
+		if w.timer != nil {
+			w.timer.Stop()
+		}
+		w.mu.Unlock()
+		err = w.fs.Close()
+	}
+	// wait for a reload in progress
+	c.reloads.Lock()
+	defer c.reloads.Unlock()
+	return err
+}
+
+func (c *Vipers) watch(w *configWatcher) {
+	for {
+		select {
+		case _, ok := <-w.fs.Events:
+			if !ok {
+				return
+			}
+			w.mu.Lock()
+			if !w.closed {
+				if w.timer != nil {
+					w.timer.Stop()
+				}
+				w.timer = time.AfterFunc(watchDebounce, func() {
+					c.rescan(w)
+				})
+			}
+			w.mu.Unlock()
+		case err, ok := <-w.fs.Errors:
+			if !ok {
+				return
+			}
+			c.logger().Error("config watcher error", "error", err)
+		}
+	}
+}
+
+// rescan reloads the sections whose layer files or content changed, and
+// calls their subscribers.
+func (c *Vipers) rescan(w *configWatcher) {
+	c.reloads.Lock()
+	defer c.reloads.Unlock()
+	w.mu.Lock()
+	closed := w.closed
+	w.mu.Unlock()
+	if closed {
+		return
+	}
+
+	// a backup or swap file written by an editor must not stop the
+	// reloads of every section
+	layers, err := scanConfigDir(c.dir, c.chain, func(file string) error {
+		c.logger().Warn("skipping unsupported config file", "file", filepath.Join(c.dir, file))
+		return nil
+	})
+	if err != nil {
+		c.logger().Error("rescan config dir error", "dir", c.dir, "error", err)
+		return
+	}
+
+	c.mu.Lock()
+	names := make([]string, 0, len(c.files))
+	for name := range c.files {
+		names = append(names, name)
+	}
+	c.mu.Unlock()
+	slices.Sort(names)
+
+	for _, name := range names {
+		files := layers[name]
+		if len(files) == 0 {
+			// every layer is gone, keep the last content until one is
+			// created again
+			continue
+		}
+		if err := c.reload(name, files); err != nil {
+			c.logger().Error("reload config error", "section", name, "error", err)
+		}
+	}
+}
+
+// reload loads section name from files and the config sources, and calls
+// its subscribers unless neither the files nor the content changed.
+// c.reloads must be held.
+func (c *Vipers) reload(name string, files []string) error {
+	c.mu.Lock()
+	prev := c.encoders[name]
+	prevFiles, prevSum := c.files[name], c.sums[name]
+	prevSecrets, prevOrigins := c.secrets[name], c.origins[name]
+	c.files[name] = files
+	vp, err := c.load(name)
+	if err != nil {
+		c.files[name], c.sums[name] = prevFiles, prevSum
+		c.secrets[name], c.origins[name] = prevSecrets, prevOrigins
+		c.mu.Unlock()
+		return err
+	}
+	if c.sums[name] == prevSum && slices.Equal(files, prevFiles) {
+		c.mu.Unlock()
+		return nil
+	}
+	c.encoders[name] = vp
+	var change *ConfigChange
+	if prev != nil {
+		secrets := append(slices.Clone(prevSecrets), c.secrets[name]...)
+		change = diffSettings(name, prev.AllSettings(), vp.AllSettings(), secrets, c.origins[name])
+	}
+	subs := slices.Clone(c.subs[name])
+	c.mu.Unlock()
+	if change != nil && len(change.Keys) > 0 {
+		c.audit.record(c.logger(), change)
+	}
+	for _, s := range subs {
+		s.callback(vp)
+	}
+	return nil
+}
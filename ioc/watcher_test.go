@@ -0,0 +1,128 @@
+package ioc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// watchedKeys receives the "key" value of each reload of a section.
+type watchedKeys chan string
+
+func newWatchedKeys() watchedKeys {
+	return make(watchedKeys, 16)
+}
+
+func (w watchedKeys) add(v *viper.Viper) {
+	w <- v.GetString("key")
+}
+
+// assertNoReload fails when a reload comes within a few debounce periods.
+func (w watchedKeys) assertNoReload(t *testing.T) {
+	t.Helper()
+	select {
+	case key := <-w:
+		t.Errorf("unexpected reload with key %q", key)
+	case <-time.After(3 * watchDebounce):
+	}
+}
+
+func TestVipers_WatchRename(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.test.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("key: v1\n"), 0644))
+
+	vipers, err := NewVipers(dir, ConfigEnvTest)
+	assert.NoError(t, err)
+	defer vipers.Close()
+	w := newWatchedKeys()
+	assert.NoError(t, vipers.WatchConfig("config", w.add))
+
+	// editors saving through a temporary file
+	tmp := filepath.Join(dir, ".config.test.yaml.swp")
+	assert.NoError(t, os.WriteFile(tmp, []byte("key: v2\n"), 0644))
+	assert.NoError(t, os.Rename(tmp, file))
+	assert.Equal(t, "v2", waitFor(t, w))
+
+	// removed, then created again
+	assert.NoError(t, os.Remove(file))
+	w.assertNoReload(t)
+	assert.NoError(t, os.WriteFile(file, []byte("key: v3\n"), 0644))
+	assert.Equal(t, "v3", waitFor(t, w))
+
+	// events without content change do not reload
+	assert.NoError(t, os.WriteFile(file, []byte("key: v3\n"), 0644))
+	w.assertNoReload(t)
+}
+
+func TestVipers_WatchSkipsUnsupportedFiles(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.test.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("key: v1\n"), 0644))
+
+	vipers, err := NewVipers(dir, ConfigEnvTest)
+	assert.NoError(t, err)
+	defer vipers.Close()
+	w := newWatchedKeys()
+	assert.NoError(t, vipers.WatchConfig("config", w.add))
+
+	// an editor backup next to the file does not stop the reloads
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "config.test.bak"), []byte("key: v1\n"), 0644))
+	assert.NoError(t, os.WriteFile(file, []byte("key: v2\n"), 0644))
+	assert.Equal(t, "v2", waitFor(t, w))
+}
+
+func TestVipers_WatchSymlinkSwap(t *testing.T) {
+	// the layout of a Kubernetes ConfigMap volume
+	dir := t.TempDir()
+	writeVersion := func(version, content string) {
+		d := filepath.Join(dir, "..v"+version)
+		assert.NoError(t, os.Mkdir(d, 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(d, "config.test.yaml"), []byte(content), 0644))
+		link := filepath.Join(dir, "..data_tmp")
+		assert.NoError(t, os.Symlink("..v"+version, link))
+		assert.NoError(t, os.Rename(link, filepath.Join(dir, "..data")))
+	}
+	writeVersion("1", "key: v1\n")
+	assert.NoError(t, os.Symlink(filepath.Join("..data", "config.test.yaml"), filepath.Join(dir, "config.test.yaml")))
+
+	vipers, err := NewVipers(dir, ConfigEnvTest)
+	assert.NoError(t, err)
+	defer vipers.Close()
+	w := newWatchedKeys()
+	assert.NoError(t, vipers.WatchConfig("config", w.add))
+
+	writeVersion("2", "key: v2\n")
+	assert.Equal(t, "v2", waitFor(t, w))
+}
+
+func TestVipers_Subscribe(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.test.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("key: v1\n"), 0644))
+
+	vipers, err := NewVipers(dir, ConfigEnvTest)
+	assert.NoError(t, err)
+	first, second := newWatchedKeys(), newWatchedKeys()
+	unsubscribe, err := vipers.Subscribe("config", first.add)
+	assert.NoError(t, err)
+	_, err = vipers.Subscribe("config", second.add)
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.WriteFile(file, []byte("key: v2\n"), 0644))
+	assert.Equal(t, "v2", waitFor(t, first))
+	assert.Equal(t, "v2", waitFor(t, second))
+	unsubscribe()
+	assert.NoError(t, os.WriteFile(file, []byte("key: v3\n"), 0644))
+	assert.Equal(t, "v3", waitFor(t, second))
+	first.assertNoReload(t)
+
+	// nothing is called once closed
+	assert.NoError(t, vipers.Close())
+	assert.NoError(t, os.WriteFile(file, []byte("key: v4\n"), 0644))
+	second.assertNoReload(t)
+}
@@ -2,8 +2,6 @@ package dingtalk
 
 import (
 	"github.com/aiechoic/services/ioc"
-	"github.com/spf13/viper"
-	"log"
 )
 
 const (
@@ -25,16 +23,17 @@ secret: "your_secret"
 
 var providers = ioc.NewProviders[*Client]()
 
+func init() {
+	ioc.RegisterDefaultConfig(ConfigKey, defaultConfigData)
+	ioc.RegisterConfigType(ConfigKey, Config{})
+}
+
 func GetProvider(configSection string) *ioc.Provider[*Client] {
 	return providers.GetProvider(configSection, func(c *ioc.Container) (*Client, error) {
 		client := NewClient()
-		err := c.UnmarshalAndWatchConfig(configSection, defaultConfigData, func(v *viper.Viper) {
-			var cfg Config
-			err := v.Unmarshal(&cfg)
-			if err != nil {
-				log.Println(err)
-			}
-			client.UpdateConfig(&cfg)
+		err := ioc.WatchTyped(c, configSection, defaultConfigData, func(cfg *Config) error {
+			client.UpdateConfig(cfg)
+			return nil
 		})
 		if err != nil {
 			return nil, err
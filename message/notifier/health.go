@@ -0,0 +1,140 @@
+package notifier
+
+import (
+	"fmt"
+	"github.com/aiechoic/services/ioc/healthy"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// DefaultHealthThresholds alerts fatal problems immediately, errors after 3
+// consecutive failed checks and warnings after 10. Lower levels are not
+// alerted.
+var DefaultHealthThresholds = map[healthy.Level]int{
+	healthy.LFatal: 1,
+	healthy.LError: 3,
+	healthy.LWarn:  10,
+}
+
+type healthProblem struct {
+	level    healthy.Level
+	msg      string
+	count    int
+	notified healthy.Level // level last notified, empty if none
+}
+
+// HealthAlerter routes health check errors to a Notifier. A problem is
+// notified once it has been reported by as many consecutive checks as the
+// threshold of its level, and again only when its level changes. When a
+// notified problem disappears a "resolved" message is sent. Messages that
+// fail to be sent are retried on the next check.
+type HealthAlerter struct {
+	notifier   Notifier
+	thresholds map[healthy.Level]int
+	problems   map[string]*healthProblem
+	resolved   map[string]*healthProblem
+	logger     *slog.Logger
+	mu         sync.Mutex
+}
+
+// NewHealthAlerter returns an alerter using the given thresholds, keyed by
+// the lowest number of consecutive failed checks that triggers an alert.
+// Levels without a threshold are never alerted.
+func NewHealthAlerter(n Notifier, thresholds map[healthy.Level]int) *HealthAlerter {
+	return &HealthAlerter{
+		notifier:   n,
+		thresholds: thresholds,
+		problems:   map[string]*healthProblem{},
+		resolved:   map[string]*healthProblem{},
+		logger:     slog.Default(),
+	}
+}
+
+// SetLogger sets the logger of the notify errors, slog.Default by default.
+func (a *HealthAlerter) SetLogger(logger *slog.Logger) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.logger = logger
+}
+
+// Handle processes the result of one round of health checks, it can be
+// passed to ioc.Container.RunHealthCheck.
+func (a *HealthAlerter) Handle(errs []*healthy.Error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	seen := map[string]bool{}
+	var alerts []string
+	for _, err := range errs {
+		key := err.Component
+		if key == "" {
+			key = err.Msg
+		}
+		seen[key] = true
+		delete(a.resolved, key)
+		p, ok := a.problems[key]
+		if !ok {
+			p = &healthProblem{}
+			a.problems[key] = p
+		}
+		if p.level != err.Level {
+			// the threshold of the new level counts from its first round
+			p.count = 0
+			p.level = err.Level
+		}
+		p.count++
+		p.msg = err.Msg
+		threshold, ok := a.thresholds[p.level]
+		if ok && p.count >= threshold && p.notified != p.level {
+			alerts = append(alerts, key)
+		}
+	}
+	for key, p := range a.problems {
+		if seen[key] {
+			continue
+		}
+		if p.notified != "" {
+			a.resolved[key] = p
+		}
+		delete(a.problems, key)
+	}
+	if len(alerts) == 0 && len(a.resolved) == 0 {
+		return
+	}
+
+	err := a.notifier.Notify(a.message(alerts))
+	if err != nil {
+		a.logger.Error("notify health alert error", "error", err)
+		return
+	}
+	for _, key := range alerts {
+		a.problems[key].notified = a.problems[key].level
+	}
+	clear(a.resolved)
+}
+
+func (a *HealthAlerter) message(alerts []string) string {
+	var b strings.Builder
+	if len(alerts) > 0 {
+		slices.Sort(alerts)
+		b.WriteString("#### Health alert\n")
+		for _, key := range alerts {
+			p := a.problems[key]
+			fmt.Fprintf(&b, "- **[%s] %s**: %s (%d consecutive checks)\n", p.level, key, p.msg, p.count)
+		}
+	}
+	if len(a.resolved) > 0 {
+		keys := make([]string, 0, len(a.resolved))
+		for key := range a.resolved {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		b.WriteString("#### Resolved\n")
+		for _, key := range keys {
+			fmt.Fprintf(&b, "- **%s**: %s\n", key, a.resolved[key].msg)
+		}
+	}
+	return b.String()
+}
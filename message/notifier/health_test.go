@@ -0,0 +1,93 @@
+package notifier
+
+import (
+	"errors"
+	"github.com/aiechoic/services/ioc/healthy"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type recordNotifier struct {
+	messages []string
+	fail     bool
+}
+
+func (r *recordNotifier) Notify(message string) error {
+	if r.fail {
+		return errors.New("sending messages too frequently, please wait")
+	}
+	r.messages = append(r.messages, message)
+	return nil
+}
+
+func TestHealthAlerter(t *testing.T) {
+	n := &recordNotifier{}
+	a := NewHealthAlerter(n, map[healthy.Level]int{
+		healthy.LError: 2,
+		healthy.LFatal: 1,
+	})
+	queueErr := func(level healthy.Level) []*healthy.Error {
+		return []*healthy.Error{{Component: "email-pusher", Level: level, Msg: "email queue length: 25"}}
+	}
+
+	// below the threshold
+	a.Handle(queueErr(healthy.LError))
+	assert.Empty(t, n.messages)
+
+	a.Handle(queueErr(healthy.LError))
+	assert.Len(t, n.messages, 1)
+	assert.Contains(t, n.messages[0], "[error] email-pusher")
+
+	// identical ongoing problem is not notified again
+	a.Handle(queueErr(healthy.LError))
+	assert.Len(t, n.messages, 1)
+
+	// escalation is notified
+	a.Handle(queueErr(healthy.LFatal))
+	assert.Len(t, n.messages, 2)
+	assert.Contains(t, n.messages[1], "[fatal] email-pusher")
+
+	// recovery is retried until the notifier accepts it
+	n.fail = true
+	a.Handle(nil)
+	assert.Len(t, n.messages, 2)
+	n.fail = false
+	a.Handle(nil)
+	assert.Len(t, n.messages, 3)
+	assert.Contains(t, n.messages[2], "Resolved")
+
+	a.Handle(nil)
+	assert.Len(t, n.messages, 3)
+}
+
+func TestHealthAlerterIgnoresLevelsWithoutThreshold(t *testing.T) {
+	n := &recordNotifier{}
+	a := NewHealthAlerter(n, DefaultHealthThresholds)
+	for i := 0; i < 20; i++ {
+		a.Handle([]*healthy.Error{{Component: "queue", Level: healthy.LInfo, Msg: "busy"}})
+	}
+	a.Handle(nil)
+	assert.Empty(t, n.messages)
+}
+
+func TestHealthAlerterCountsPerLevel(t *testing.T) {
+	n := &recordNotifier{}
+	a := NewHealthAlerter(n, map[healthy.Level]int{
+		healthy.LWarn:  2,
+		healthy.LError: 2,
+	})
+	queueErr := func(level healthy.Level) []*healthy.Error {
+		return []*healthy.Error{{Component: "queue", Level: level, Msg: "busy"}}
+	}
+
+	// a problem flapping between levels never reaches either threshold
+	for i := 0; i < 5; i++ {
+		a.Handle(queueErr(healthy.LError))
+		a.Handle(queueErr(healthy.LWarn))
+	}
+	assert.Empty(t, n.messages)
+
+	a.Handle(queueErr(healthy.LWarn))
+	assert.Len(t, n.messages, 1)
+	assert.Contains(t, n.messages[0], "[warn] queue")
+}